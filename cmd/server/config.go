@@ -0,0 +1,699 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+	"github.com/mstephenholl/gitops-demo/internal/flags"
+	"github.com/mstephenholl/gitops-demo/internal/handlers"
+	"github.com/mstephenholl/gitops-demo/internal/instance"
+	"github.com/mstephenholl/gitops-demo/internal/listener"
+)
+
+// config holds the server settings resolved from the environment, the .env
+// files and the optional config file.
+type config struct {
+	Port string
+
+	// AppEnv is the profile, dev, staging or prod, whose defaults apply
+	// beneath every other source.
+	AppEnv string
+	// EnvFiles are the .env files that were found and read.
+	EnvFiles []string
+	// ConfigFile is the YAML or TOML file layered under the environment
+	// and .env files, named by CONFIG_FILE.
+	ConfigFile string
+
+	// LogFormat is json or text.
+	LogFormat string
+	LogLevel  slog.Level
+
+	// Instance identifies this pod, from the downward API environment
+	// variables and the volume mounted at DOWNWARD_API_DIR. It is not a
+	// setting, since it differs between replicas by design.
+	Instance instance.Info
+
+	// DebugRoutesEnabled mounts the profiling and diagnostic routes under
+	// /debug, behind the debug scope when authentication is enabled.
+	DebugRoutesEnabled bool
+
+	// Listen are the addresses served, in the forms accepted by
+	// listener.ParseAddr. It defaults to every interface on Port.
+	Listen []string
+	// UnixSocketMode is the permission set on Unix domain sockets.
+	UnixSocketMode fs.FileMode
+
+	// GracefulRestartEnabled makes SIGUSR2 start a new copy of the binary
+	// on the same listeners. This process drains once the new one reports
+	// ready, or keeps serving if it is not ready within
+	// GracefulRestartTimeout.
+	GracefulRestartEnabled bool
+	GracefulRestartTimeout time.Duration
+
+	// ShutdownDrainDelay is how long the server fails its readiness probe
+	// but keeps serving after SIGTERM, before it closes its listeners.
+	ShutdownDrainDelay time.Duration
+
+	// ProbeTimeout and RequestTimeout bound handler run time for the probe
+	// routes and for every other route respectively.
+	ProbeTimeout   time.Duration
+	RequestTimeout time.Duration
+
+	// MaxBodyBytes is the default request body limit for API routes.
+	MaxBodyBytes int64
+
+	// MaxConnections caps open client connections across all listeners;
+	// zero means no limit. Connections recycles keep-alive connections.
+	MaxConnections int
+	Connections    handlers.ConnConfig
+
+	ConcurrencyLimitEnabled bool
+	ConcurrencyLimit        handlers.ConcurrencyLimitConfig
+
+	// TrustedProxies are the peers whose forwarding headers are believed
+	// when resolving client IPs and the request scheme.
+	TrustedProxies []netip.Prefix
+
+	// ProxyProtocolEnabled makes the listener parse PROXY protocol headers
+	// sent by ProxyProtocolTrusted peers, waiting up to ProxyProtocolTimeout
+	// for one on each new connection.
+	ProxyProtocolEnabled bool
+	ProxyProtocolTrusted []netip.Prefix
+	ProxyProtocolTimeout time.Duration
+
+	SecurityHeadersEnabled bool
+	SecurityHeaders        handlers.SecurityHeadersConfig
+
+	// APIKeys are the static credentials accepted on non-probe routes,
+	// from API_KEYS and the file named by API_KEYS_FILE. Authentication is
+	// disabled when there are none at startup and no JWKS; reloads replace
+	// the keys only if it is enabled.
+	APIKeys []auth.Key
+
+	// JWKS is the file path or URL of the key set used to verify JWTs.
+	// JWT validation is disabled when it is empty.
+	JWKS        string
+	JWKSRefresh time.Duration
+	JWT         auth.JWTConfig
+
+	CompressionEnabled bool
+	Compression        handlers.CompressConfig
+
+	// CORS is enabled when at least one allowed origin is configured.
+	CORS handlers.CORSConfig
+
+	// Maintenance is the response served in maintenance mode. Maintenance
+	// mode is on while MaintenanceFile exists, and can also be switched
+	// with SIGUSR1 or the admin API.
+	Maintenance     handlers.MaintenanceConfig
+	MaintenanceFile string
+
+	// Flags are the feature flags from FLAGS and the file named by
+	// FLAGS_FILE. Reloads replace them; runtime overrides are kept.
+	Flags []flags.Flag
+
+	// authEnabled is whether API keys or a JWKS were configured. Reloads
+	// keep the value from startup, since the routes are built with or
+	// without authentication once.
+	authEnabled bool
+
+	// settings records how each key was resolved, in the order read.
+	settings []setting
+	// files are the NAME_FILE secrets and the flags file, watched for
+	// changes.
+	files []string
+}
+
+// fingerprint is a stable hash of the non-secret effective settings,
+// including the contents of the flags file. It ignores where values came
+// from, so replicas configured the same way through different sources
+// match, and leaves secrets out entirely.
+func (c config) fingerprint() string {
+	settings := slices.Clone(c.settings)
+	slices.SortFunc(settings, func(a, b setting) int { return strings.Compare(a.Key, b.Key) })
+
+	h := sha256.New()
+	for _, s := range settings {
+		switch {
+		case s.Secret:
+		case s.hashContents:
+			fmt.Fprintf(h, "%s=%q %x\n", s.Key, s.Value, s.digest)
+		default:
+			fmt.Fprintf(h, "%s=%q\n", s.Key, s.Value)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// LogValue logs the effective settings rather than the fields, so that
+// secrets stay redacted if a config is ever logged whole.
+func (c config) LogValue() slog.Value {
+	attrs := make([]slog.Attr, len(c.settings))
+	for i, s := range c.settings {
+		attrs[i] = slog.String(s.Key, s.Value)
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// loadConfig reads the server configuration from, highest precedence first,
+// environment variables, the .env.local, .env.<APP_ENV> and .env files, the
+// file named by CONFIG_FILE and the APP_ENV profile, applying defaults for
+// anything unset. All invalid values are reported together in the returned
+// error.
+func loadConfig() (config, error) {
+	env := source{name: "env", lookup: os.LookupEnv}
+	files, appEnv, err := readEnvFiles(env)
+	if err != nil {
+		return config{}, err
+	}
+	sources := append([]source{env}, files...)
+
+	path, _, _ := lookupFirst("CONFIG_FILE", sources...)
+	var fileValues map[string]string
+	if path != "" {
+		if fileValues, err = readConfigFile(path); err != nil {
+			return config{}, err
+		}
+		sources = append(sources, source{name: path, lookup: mapLookup(fileValues)})
+	}
+
+	p := parser{sources: append(sources, profileSource(appEnv.Value)), settings: []setting{appEnv}}
+
+	cfg := config{
+		Port:       p.string("PORT", "8080"),
+		AppEnv:     appEnv.Value,
+		ConfigFile: path,
+		LogFormat:  p.string("LOG_FORMAT", "json"),
+		LogLevel:   p.level("LOG_LEVEL", slog.LevelInfo),
+
+		DebugRoutesEnabled: p.bool("DEBUG_ROUTES_ENABLED", false),
+
+		UnixSocketMode: p.fileMode("UNIX_SOCKET_MODE", 0o660),
+
+		GracefulRestartEnabled: p.bool("GRACEFUL_RESTART_ENABLED", false),
+		GracefulRestartTimeout: p.duration("GRACEFUL_RESTART_TIMEOUT", 30*time.Second),
+
+		ShutdownDrainDelay: p.duration("SHUTDOWN_DRAIN_DELAY", 0),
+
+		ProbeTimeout:   p.duration("PROBE_TIMEOUT", 2*time.Second),
+		RequestTimeout: p.duration("REQUEST_TIMEOUT", 10*time.Second),
+
+		MaxBodyBytes: int64(p.int("MAX_BODY_BYTES", 1<<20)),
+
+		MaxConnections: p.int("MAX_CONNECTIONS", 0),
+		Connections: handlers.ConnConfig{
+			MaxRequests: p.int("CONN_MAX_REQUESTS", 0),
+			MaxAge:      p.duration("CONN_MAX_AGE", 0),
+		},
+
+		ConcurrencyLimitEnabled: p.bool("CONCURRENCY_LIMIT_ENABLED", true),
+		ConcurrencyLimit: handlers.ConcurrencyLimitConfig{
+			InitialLimit:  p.int("CONCURRENCY_LIMIT_INITIAL", 20),
+			MinLimit:      p.int("CONCURRENCY_LIMIT_MIN", 5),
+			MaxLimit:      p.int("CONCURRENCY_LIMIT_MAX", 200),
+			LatencyTarget: p.duration("CONCURRENCY_LATENCY_TARGET", 250*time.Millisecond),
+			Backoff:       p.float("CONCURRENCY_BACKOFF", 0.9),
+		},
+
+		TrustedProxies: p.prefixes("TRUSTED_PROXIES"),
+
+		ProxyProtocolEnabled: p.bool("PROXY_PROTOCOL_ENABLED", false),
+		ProxyProtocolTrusted: p.prefixes("PROXY_PROTOCOL_TRUSTED"),
+		ProxyProtocolTimeout: p.duration("PROXY_PROTOCOL_TIMEOUT", 5*time.Second),
+
+		SecurityHeadersEnabled: p.bool("SECURITY_HEADERS_ENABLED", true),
+		SecurityHeaders: handlers.SecurityHeadersConfig{
+			ContentTypeOptions:    p.string("CONTENT_TYPE_OPTIONS", "nosniff"),
+			ReferrerPolicy:        p.string("REFERRER_POLICY", "no-referrer"),
+			ContentSecurityPolicy: p.string("CONTENT_SECURITY_POLICY", "default-src 'none'; frame-ancestors 'none'"),
+			CacheControl:          p.string("CACHE_CONTROL", "no-store"),
+			HSTSMaxAge:            p.duration("HSTS_MAX_AGE", 365*24*time.Hour),
+			HSTSIncludeSubdomains: p.bool("HSTS_INCLUDE_SUBDOMAINS", false),
+			TrustForwardedProto:   p.bool("TRUST_FORWARDED_PROTO", false),
+			RemoveHeaders:         p.list("REMOVE_RESPONSE_HEADERS", []string{"Server", "X-Powered-By"}),
+		},
+
+		APIKeys: p.keys("API_KEYS"),
+
+		JWKS:        p.string("JWT_JWKS", ""),
+		JWKSRefresh: p.duration("JWT_JWKS_REFRESH", 5*time.Minute),
+		JWT: auth.JWTConfig{
+			Issuer:   p.string("JWT_ISSUER", ""),
+			Audience: p.string("JWT_AUDIENCE", ""),
+			Leeway:   p.duration("JWT_LEEWAY", 30*time.Second),
+		},
+
+		CompressionEnabled: p.bool("COMPRESSION_ENABLED", true),
+		Compression: handlers.CompressConfig{
+			MinSize:      p.int("COMPRESSION_MIN_SIZE", 1024),
+			ContentTypes: p.list("COMPRESSION_TYPES", []string{"application/json", "text/*"}),
+		},
+
+		CORS: handlers.CORSConfig{
+			AllowedOrigins:   p.list("CORS_ALLOWED_ORIGINS", nil),
+			AllowedMethods:   p.list("CORS_ALLOWED_METHODS", []string{"GET", "HEAD"}),
+			AllowedHeaders:   p.list("CORS_ALLOWED_HEADERS", []string{"Accept", "Content-Type"}),
+			AllowCredentials: p.bool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           p.duration("CORS_MAX_AGE", 10*time.Minute),
+		},
+
+		Maintenance: handlers.MaintenanceConfig{
+			Message:    p.string("MAINTENANCE_MESSAGE", "service is down for maintenance"),
+			RetryAfter: p.duration("MAINTENANCE_RETRY_AFTER", 5*time.Minute),
+			Allowlist:  p.prefixes("MAINTENANCE_ALLOWLIST"),
+		},
+		MaintenanceFile: p.string("MAINTENANCE_FILE", ""),
+
+		Flags: p.flags("FLAGS"),
+	}
+
+	cfg.Listen = p.list("LISTEN", []string{":" + cfg.Port})
+	if cfg.Instance, err = instance.Load(os.LookupEnv, p.string("DOWNWARD_API_DIR", "")); err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid DOWNWARD_API_DIR: %w", err))
+	}
+	cfg.settings = p.settings
+	cfg.files = p.files
+	cfg.authEnabled = len(cfg.APIKeys) > 0 || cfg.JWKS != ""
+	for _, src := range files {
+		cfg.EnvFiles = append(cfg.EnvFiles, src.name)
+	}
+
+	// Catch typos in the file, which would otherwise be silently ignored.
+	for key := range fileValues {
+		if cfg.setting(key) == nil {
+			p.errs = append(p.errs, fmt.Errorf("unknown setting %s in %s", key, path))
+		}
+	}
+
+	if err := p.err(); err != nil {
+		return config{}, err
+	}
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// setting returns how key was resolved, or nil if it is not a known key.
+func (c config) setting(key string) *setting {
+	for i := range c.settings {
+		if c.settings[i].Key == key {
+			return &c.settings[i]
+		}
+	}
+	return nil
+}
+
+// validate checks relationships between settings that parse individually.
+func (c config) validate() error {
+	var errs []error
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or text, got %q", c.LogFormat))
+	}
+
+	for _, addr := range c.Listen {
+		if _, err := listener.ParseAddr(addr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid LISTEN: %w", err))
+		}
+	}
+
+	if c.GracefulRestartEnabled && c.GracefulRestartTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("GRACEFUL_RESTART_TIMEOUT must be positive, got %v", c.GracefulRestartTimeout))
+	}
+
+	if c.ShutdownDrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_DRAIN_DELAY must not be negative, got %v", c.ShutdownDrainDelay))
+	}
+	if c.ProbeTimeout < 0 {
+		errs = append(errs, fmt.Errorf("PROBE_TIMEOUT must not be negative, got %v", c.ProbeTimeout))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, fmt.Errorf("REQUEST_TIMEOUT must not be negative, got %v", c.RequestTimeout))
+	}
+	if c.Maintenance.RetryAfter < 0 {
+		errs = append(errs, fmt.Errorf("MAINTENANCE_RETRY_AFTER must not be negative, got %v", c.Maintenance.RetryAfter))
+	}
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_BODY_BYTES must be positive, got %d", c.MaxBodyBytes))
+	}
+
+	if c.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("MAX_CONNECTIONS must not be negative, got %d", c.MaxConnections))
+	}
+	if c.Connections.MaxRequests < 0 {
+		errs = append(errs, fmt.Errorf("CONN_MAX_REQUESTS must not be negative, got %d", c.Connections.MaxRequests))
+	}
+	if c.Connections.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("CONN_MAX_AGE must not be negative, got %v", c.Connections.MaxAge))
+	}
+
+	cl := c.ConcurrencyLimit
+	if cl.MinLimit < 1 || cl.MinLimit > cl.InitialLimit || cl.InitialLimit > cl.MaxLimit {
+		errs = append(errs, fmt.Errorf("concurrency limits must satisfy 1 <= min (%d) <= initial (%d) <= max (%d)",
+			cl.MinLimit, cl.InitialLimit, cl.MaxLimit))
+	}
+	if cl.Backoff <= 0 || cl.Backoff >= 1 {
+		errs = append(errs, fmt.Errorf("CONCURRENCY_BACKOFF must be between 0 and 1, got %v", cl.Backoff))
+	}
+	if cl.LatencyTarget <= 0 {
+		errs = append(errs, fmt.Errorf("CONCURRENCY_LATENCY_TARGET must be positive, got %v", cl.LatencyTarget))
+	}
+
+	if c.ProxyProtocolEnabled {
+		if len(c.ProxyProtocolTrusted) == 0 {
+			errs = append(errs, errors.New("PROXY_PROTOCOL_TRUSTED is required when PROXY_PROTOCOL_ENABLED is set"))
+		}
+		if c.ProxyProtocolTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("PROXY_PROTOCOL_TIMEOUT must be positive, got %v", c.ProxyProtocolTimeout))
+		}
+	}
+
+	if c.Compression.MinSize < 0 {
+		errs = append(errs, fmt.Errorf("COMPRESSION_MIN_SIZE must not be negative, got %d", c.Compression.MinSize))
+	}
+
+	if c.JWKS != "" {
+		if c.JWT.Issuer == "" || c.JWT.Audience == "" {
+			errs = append(errs, errors.New("JWT_ISSUER and JWT_AUDIENCE are required when JWT_JWKS is set"))
+		}
+		if c.JWKSRefresh <= 0 {
+			errs = append(errs, fmt.Errorf("JWT_JWKS_REFRESH must be positive, got %v", c.JWKSRefresh))
+		}
+	}
+
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		errs = append(errs, errors.New("CORS_ALLOW_CREDENTIALS cannot be combined with CORS_ALLOWED_ORIGINS=*"))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin != "*" && strings.Count(origin, "*") > 1 {
+			errs = append(errs, fmt.Errorf("CORS origin %q may contain at most one wildcard", origin))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// source is one layer of configuration values, such as the environment, a
+// .env file or the config file.
+type source struct {
+	name   string
+	lookup func(key string) (string, bool)
+}
+
+func mapLookup(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+// setting records how a configuration key was resolved.
+type setting struct {
+	Key string
+	// Value is the effective value as text; Default is the value used when
+	// no source sets the key.
+	Value   string
+	Default string
+	// Source names the layer that set the key, or is "default".
+	Source string
+	// Secret settings never hold their value: Value is redacted once set.
+	Secret bool
+
+	// digest identifies a secret value, or the contents of a file, so that
+	// reloads can tell when it changed.
+	digest [sha256.Size]byte
+	// hashContents marks a digest of a non-secret file, such as the flags
+	// file, which the fingerprint includes since the path alone does not
+	// say what the file holds.
+	hashContents bool
+}
+
+// parser reads typed values from the first source that sets each key,
+// recording parse errors instead of failing on the first one. Empty values
+// are treated as unset.
+type parser struct {
+	sources  []source
+	settings []setting
+	files    []string
+	errs     []error
+}
+
+// value looks key up and records the resolved setting, with def as the text
+// of the fallback value.
+func (p *parser) value(key, def string) (string, bool) {
+	for _, src := range p.sources {
+		if v, ok := src.lookup(key); ok && v != "" {
+			p.settings = append(p.settings, setting{Key: key, Value: v, Default: def, Source: src.name})
+			return v, true
+		}
+	}
+	p.settings = append(p.settings, setting{Key: key, Value: def, Default: def, Source: "default"})
+	return "", false
+}
+
+// secretValue is value for a key that must never be logged or exposed.
+// The recorded setting holds only a digest of the value, for detecting
+// changes.
+func (p *parser) secretValue(key string) (string, bool) {
+	v, ok := p.value(key, "")
+	s := &p.settings[len(p.settings)-1]
+	s.Secret = true
+	if ok {
+		s.Value, s.digest = redacted, sha256.Sum256([]byte(v))
+	}
+	return v, ok
+}
+
+// secretFile reads a secret from the file named by key, following the NAME_FILE
+// convention for mounted Kubernetes Secrets. The path is recorded as the
+// setting's value along with a digest of the contents, so that a rotated
+// secret shows up as a change; the file is watched for reloads.
+func (p *parser) secretFile(key string) (string, bool) {
+	path, ok := p.value(key, "")
+	if !ok {
+		return "", false
+	}
+	v, err := readSecretFile(path)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s: %w", key, err))
+		return "", false
+	}
+	p.settings[len(p.settings)-1].digest = sha256.Sum256([]byte(v))
+	p.files = append(p.files, path)
+	return v, true
+}
+
+func (p *parser) fail(key, v string, err error) {
+	p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", key, v, err))
+}
+
+func (p *parser) string(key, fallback string) string {
+	if v, ok := p.value(key, fallback); ok {
+		return v
+	}
+	return fallback
+}
+
+func (p *parser) bool(key string, fallback bool) bool {
+	v, ok := p.value(key, strconv.FormatBool(fallback))
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return b
+}
+
+func (p *parser) int(key string, fallback int) int {
+	v, ok := p.value(key, strconv.Itoa(fallback))
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return n
+}
+
+func (p *parser) float(key string, fallback float64) float64 {
+	v, ok := p.value(key, strconv.FormatFloat(fallback, 'g', -1, 64))
+	if !ok {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return f
+}
+
+func (p *parser) duration(key string, fallback time.Duration) time.Duration {
+	v, ok := p.value(key, fallback.String())
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return d
+}
+
+// level parses a slog level name such as debug, info, warn or error.
+func (p *parser) level(key string, fallback slog.Level) slog.Level {
+	v, ok := p.value(key, strings.ToLower(fallback.String()))
+	if !ok {
+		return fallback
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(v)); err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return l
+}
+
+// fileMode parses an octal permission such as 0660.
+func (p *parser) fileMode(key string, fallback fs.FileMode) fs.FileMode {
+	v, ok := p.value(key, fmt.Sprintf("%#o", uint32(fallback)))
+	if !ok {
+		return fallback
+	}
+	m, err := strconv.ParseUint(v, 8, 32)
+	if err == nil && m&^uint64(fs.ModePerm) != 0 {
+		err = errors.New("not a permission mode")
+	}
+	if err != nil {
+		p.fail(key, v, err)
+		return fallback
+	}
+	return fs.FileMode(m)
+}
+
+// list splits a comma-separated value, dropping empty entries.
+func (p *parser) list(key string, fallback []string) []string {
+	v, ok := p.value(key, strings.Join(fallback, ","))
+	if !ok {
+		return fallback
+	}
+	var out []string
+	for item := range strings.SplitSeq(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// prefixes parses a comma-separated list of CIDRs or bare IPs, treating a
+// bare IP as a single-address prefix.
+func (p *parser) prefixes(key string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, item := range p.list(key, nil) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				p.fail(key, item, err)
+				continue
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			p.fail(key, item, err)
+			continue
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out
+}
+
+// keys parses API keys from the key variable and from the file named by
+// key_FILE, combining both. Both are recorded as secret.
+func (p *parser) keys(key string) []auth.Key {
+	var out []auth.Key
+	if v, ok := p.secretValue(key); ok {
+		keys, err := auth.ParseKeys(v)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s: %w", key, err))
+		}
+		out = append(out, keys...)
+	}
+	fileKey := key + "_FILE"
+	if v, ok := p.secretFile(fileKey); ok {
+		keys, err := auth.ParseKeys(v)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", fileKey, p.settings[len(p.settings)-1].Value, err))
+		}
+		out = append(out, keys...)
+	}
+	return out
+}
+
+// flags parses feature flags from the key variable and from the file named
+// by key_FILE. A flag defined in both takes the definition from key. Each
+// flag's Source names where it was defined. The file is watched for
+// reloads, and a digest of its contents is recorded so edits show up as a
+// change.
+func (p *parser) flags(key string) []flags.Flag {
+	var out []flags.Flag
+	if v, ok := p.value(key, ""); ok {
+		defs, err := flags.Parse(v)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s: %w", key, err))
+		}
+		for _, f := range defs {
+			f.Source = p.settings[len(p.settings)-1].Source
+			out = append(out, f)
+		}
+	}
+
+	fileKey := key + "_FILE"
+	path, ok := p.value(fileKey, "")
+	if !ok {
+		return out
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s: %w", fileKey, err))
+		return out
+	}
+	st := &p.settings[len(p.settings)-1]
+	st.digest, st.hashContents = sha256.Sum256(data), true
+	p.files = append(p.files, path)
+	defs, err := flags.Parse(string(data))
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", fileKey, path, err))
+	}
+	for _, f := range defs {
+		if !slices.ContainsFunc(out, func(o flags.Flag) bool { return o.Name == f.Name }) {
+			f.Source = path
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (p *parser) err() error {
+	return errors.Join(p.errs...)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Port != "8080" {
+		t.Errorf("expected Port %q, got %q", "8080", cfg.Port)
+	}
+	if cfg.ProbeTimeout != 2*time.Second {
+		t.Errorf("expected ProbeTimeout 2s, got %v", cfg.ProbeTimeout)
+	}
+	if cfg.RequestTimeout != 10*time.Second {
+		t.Errorf("expected RequestTimeout 10s, got %v", cfg.RequestTimeout)
+	}
+	if cfg.MaxBodyBytes != 1<<20 {
+		t.Errorf("expected MaxBodyBytes 1MiB, got %d", cfg.MaxBodyBytes)
+	}
+	if !cfg.ConcurrencyLimitEnabled {
+		t.Error("expected concurrency limit to be enabled by default")
+	}
+	if cfg.ConcurrencyLimit.InitialLimit != 20 {
+		t.Errorf("expected InitialLimit 20, got %d", cfg.ConcurrencyLimit.InitialLimit)
+	}
+	if cfg.ConcurrencyLimit.LatencyTarget != 250*time.Millisecond {
+		t.Errorf("expected LatencyTarget 250ms, got %v", cfg.ConcurrencyLimit.LatencyTarget)
+	}
+}
+
+func TestLoadConfig_FromEnv(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("CONCURRENCY_LIMIT_ENABLED", "false")
+	t.Setenv("CONCURRENCY_LIMIT_MAX", "50")
+	t.Setenv("CONCURRENCY_LATENCY_TARGET", "1s")
+	t.Setenv("CONCURRENCY_BACKOFF", "0.5")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Port != "9090" {
+		t.Errorf("expected Port %q, got %q", "9090", cfg.Port)
+	}
+	if cfg.ConcurrencyLimitEnabled {
+		t.Error("expected concurrency limit to be disabled")
+	}
+	if cfg.ConcurrencyLimit.MaxLimit != 50 {
+		t.Errorf("expected MaxLimit 50, got %d", cfg.ConcurrencyLimit.MaxLimit)
+	}
+	if cfg.ConcurrencyLimit.LatencyTarget != time.Second {
+		t.Errorf("expected LatencyTarget 1s, got %v", cfg.ConcurrencyLimit.LatencyTarget)
+	}
+	if cfg.ConcurrencyLimit.Backoff != 0.5 {
+		t.Errorf("expected Backoff 0.5, got %v", cfg.ConcurrencyLimit.Backoff)
+	}
+}
+
+func TestLoadConfig_ReportsAllParseErrors(t *testing.T) {
+	t.Setenv("CONCURRENCY_LIMIT_ENABLED", "maybe")
+	t.Setenv("CONCURRENCY_LIMIT_MAX", "lots")
+
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected an error for invalid values")
+	}
+	for _, key := range []string{"CONCURRENCY_LIMIT_ENABLED", "CONCURRENCY_LIMIT_MAX"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error to mention %s, got: %v", key, err)
+		}
+	}
+}
+
+func TestLoadConfig_ValidatesLimits(t *testing.T) {
+	tests := map[string]map[string]string{
+		"min above initial": {"CONCURRENCY_LIMIT_MIN": "50"},
+		"initial above max": {"CONCURRENCY_LIMIT_MAX": "10"},
+		"backoff too large": {"CONCURRENCY_BACKOFF": "1.5"},
+		"zero target":       {"CONCURRENCY_LATENCY_TARGET": "0s"},
+		"negative timeout":  {"REQUEST_TIMEOUT": "-1s"},
+		"zero body limit":   {"MAX_BODY_BYTES": "0"},
+		"negative drain":    {"SHUTDOWN_DRAIN_DELAY": "-1s"},
+		"credentials with any origin": {
+			"CORS_ALLOWED_ORIGINS":   "*",
+			"CORS_ALLOW_CREDENTIALS": "true",
+		},
+		"double wildcard origin":         {"CORS_ALLOWED_ORIGINS": "https://*.*.example.com"},
+		"jwks without issuer":            {"JWT_JWKS": "/etc/jwks.json", "JWT_AUDIENCE": "gitops-demo"},
+		"proxy protocol without trusted": {"PROXY_PROTOCOL_ENABLED": "true"},
+		"proxy protocol zero timeout": {
+			"PROXY_PROTOCOL_ENABLED": "true",
+			"PROXY_PROTOCOL_TRUSTED": "10.0.0.0/8",
+			"PROXY_PROTOCOL_TIMEOUT": "0s",
+		},
+	}
+
+	for name, env := range tests {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if _, err := loadConfig(); err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_CORSLists(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example.com , ,https://*.b.example.com")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET,POST")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantOrigins := []string{"https://a.example.com", "https://*.b.example.com"}
+	if !slices.Equal(cfg.CORS.AllowedOrigins, wantOrigins) {
+		t.Errorf("expected origins %v, got %v", wantOrigins, cfg.CORS.AllowedOrigins)
+	}
+	if !slices.Equal(cfg.CORS.AllowedMethods, []string{"GET", "POST"}) {
+		t.Errorf("expected methods [GET POST], got %v", cfg.CORS.AllowedMethods)
+	}
+	if cfg.CORS.MaxAge != 10*time.Minute {
+		t.Errorf("expected MaxAge 10m, got %v", cfg.CORS.MaxAge)
+	}
+}
+
+func TestLoadConfig_APIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# mounted secret\nops:t0ken:admin\n"), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+	t.Setenv("API_KEYS", "dash:s3cret")
+	t.Setenv("API_KEYS_FILE", path)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.APIKeys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(cfg.APIKeys))
+	}
+	if cfg.APIKeys[0].ID != "dash" || cfg.APIKeys[1].ID != "ops" {
+		t.Errorf("unexpected keys: %v", cfg.APIKeys)
+	}
+}
+
+func TestLoadConfig_APIKeysErrors(t *testing.T) {
+	t.Setenv("API_KEYS", "missing-secret")
+	t.Setenv("API_KEYS_FILE", filepath.Join(t.TempDir(), "does-not-exist"))
+
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"API_KEYS", "API_KEYS_FILE"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error to mention %s, got: %v", key, err)
+		}
+	}
+}
+
+func TestLoadConfig_Flags(t *testing.T) {
+	path := writeFile(t, "flags", "# rollouts\nnew-checkout=25%\ndark-mode=false\n")
+	t.Setenv("FLAGS", "dark-mode=true")
+	t.Setenv("FLAGS_FILE", path)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, f := range cfg.Flags {
+		got[f.Name] = f.Value() + " from " + f.Source
+	}
+	want := map[string]string{
+		"dark-mode":    "true from env",
+		"new-checkout": "25% from " + path,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("expected flags %v, got %v", want, got)
+	}
+	if !slices.Contains(cfg.watchedFiles(), path) {
+		t.Errorf("expected the flags file to be watched, got %v", cfg.watchedFiles())
+	}
+}
+
+func TestLoadConfig_FlagsErrors(t *testing.T) {
+	t.Setenv("FLAGS", "rollout=150%")
+	t.Setenv("FLAGS_FILE", writeFile(t, "flags", "theme=blue\n"))
+
+	_, err := loadConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"invalid FLAGS:", "invalid FLAGS_FILE"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error to mention %s, got: %v", key, err)
+		}
+	}
+}
+
+func TestLoadConfig_Listen(t *testing.T) {
+	t.Setenv("PORT", "9090")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{":9090"}; !slices.Equal(cfg.Listen, want) {
+		t.Errorf("expected Listen to default to %v, got %v", want, cfg.Listen)
+	}
+
+	t.Setenv("LISTEN", "tcp4:0.0.0.0:8080, tcp6:[::]:8080, unix:/run/gitops-demo.sock")
+	t.Setenv("UNIX_SOCKET_MODE", "0600")
+
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"tcp4:0.0.0.0:8080", "tcp6:[::]:8080", "unix:/run/gitops-demo.sock"}
+	if !slices.Equal(cfg.Listen, want) {
+		t.Errorf("expected Listen %v, got %v", want, cfg.Listen)
+	}
+	if cfg.UnixSocketMode != 0o600 {
+		t.Errorf("expected UnixSocketMode 0600, got %o", cfg.UnixSocketMode)
+	}
+}
+
+func TestLoadConfig_TrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.42.0.0/16, 192.0.2.7, 10.43.1.1/16")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.42.0.0/16"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("10.43.0.0/16"),
+	}
+	if !slices.Equal(cfg.TrustedProxies, want) {
+		t.Errorf("expected %v, got %v", want, cfg.TrustedProxies)
+	}
+}
+
+func TestLoadConfig_TrustedProxiesInvalid(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.42.0.0/99")
+
+	if _, err := loadConfig(); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+}
+
+func TestLoadConfig_FileLayeredUnderEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", "request_timeout: 5s\nprobe_timeout: 1s\n"))
+	t.Setenv("PROBE_TIMEOUT", "3s")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RequestTimeout != 5*time.Second {
+		t.Errorf("expected RequestTimeout from the file, got %v", cfg.RequestTimeout)
+	}
+	if cfg.ProbeTimeout != 3*time.Second {
+		t.Errorf("expected the environment to override the file, got %v", cfg.ProbeTimeout)
+	}
+
+	tests := map[string]setting{
+		"REQUEST_TIMEOUT": {Key: "REQUEST_TIMEOUT", Value: "5s", Default: "10s", Source: cfg.ConfigFile},
+		"PROBE_TIMEOUT":   {Key: "PROBE_TIMEOUT", Value: "3s", Default: "2s", Source: "env"},
+		"MAX_BODY_BYTES":  {Key: "MAX_BODY_BYTES", Value: "1048576", Default: "1048576", Source: "default"},
+		"API_KEYS":        {Key: "API_KEYS", Source: "default", Secret: true},
+	}
+	for key, want := range tests {
+		got := cfg.setting(key)
+		if got == nil || *got != want {
+			t.Errorf("expected setting %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestLoadConfig_FileErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":   "request_timeot: 5s\n",
+		"invalid value": "request_timeout: soon\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", content))
+			if _, err := loadConfig(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_LogLevel(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("expected LogLevel debug, got %v", cfg.LogLevel)
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	base := testConfig(t).fingerprint()
+	if len(base) != 16 {
+		t.Fatalf("expected a 16 character fingerprint, got %q", base)
+	}
+
+	t.Setenv("API_KEYS", "dash:s3cret")
+	if got := testConfig(t).fingerprint(); got != base {
+		t.Errorf("expected secrets to be left out of the fingerprint, got %s, want %s", got, base)
+	}
+
+	path := writeFile(t, "config.yaml", "request_timeout: 10s\n")
+	t.Setenv("CONFIG_FILE", path)
+	if got := testConfig(t).fingerprint(); got != base {
+		t.Errorf("expected a default value set explicitly to match, got %s, want %s", got, base)
+	}
+
+	t.Setenv("REQUEST_TIMEOUT", "5s")
+	if got := testConfig(t).fingerprint(); got == base {
+		t.Error("expected a changed setting to change the fingerprint")
+	}
+}
+
+func TestConfigFingerprint_FlagsFileContents(t *testing.T) {
+	path := writeFile(t, "flags", "dark-mode=true\n")
+	t.Setenv("FLAGS_FILE", path)
+	base := testConfig(t).fingerprint()
+
+	if err := os.WriteFile(path, []byte("dark-mode=false\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := testConfig(t).fingerprint(); got == base {
+		t.Error("expected different flags file contents to change the fingerprint")
+	}
+
+	if err := os.WriteFile(path, []byte("dark-mode=true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := testConfig(t).fingerprint(); got != base {
+		t.Errorf("expected the same contents to match, got %s, want %s", got, base)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) config file into
+// flat settings keyed like the environment variables. Nested tables join
+// their keys with underscores and keys are upper-cased, so
+//
+//	cors:
+//	  allowed_origins: [https://a.example.com, https://b.example.com]
+//
+// sets CORS_ALLOWED_ORIGINS. Lists become comma-separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path) // #nosec G304 -- path comes from operator config
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		err = toml.Unmarshal(b, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	out := make(map[string]string)
+	if err := flatten(out, "", doc); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return out, nil
+}
+
+func flatten(out map[string]string, prefix string, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			if err := flatten(out, key, child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: lists may only contain plain values", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		out[prefix] = strings.Join(items, ",")
+	case nil:
+		// An empty value leaves the setting to the default.
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFile_Formats(t *testing.T) {
+	want := map[string]string{
+		"REQUEST_TIMEOUT":        "5s",
+		"CONCURRENCY_BACKOFF":    "0.5",
+		"MAX_BODY_BYTES":         "2048",
+		"CORS_ALLOWED_ORIGINS":   "https://a.example.com,https://b.example.com",
+		"CORS_ALLOW_CREDENTIALS": "true",
+	}
+	files := map[string]string{
+		"config.yaml": `
+request_timeout: 5s
+concurrency_backoff: 0.5
+max_body_bytes: 2048
+cors:
+  allowed-origins: [https://a.example.com, https://b.example.com]
+  allow_credentials: true
+`,
+		"config.toml": `
+request_timeout = "5s"
+concurrency_backoff = 0.5
+max_body_bytes = 2048
+
+[cors]
+allowed_origins = ["https://a.example.com", "https://b.example.com"]
+allow_credentials = true
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			got, err := readConfigFile(writeFile(t, name, content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("expected %s=%q, got %q", k, v, got[k])
+				}
+			}
+			if len(got) != len(want) {
+				t.Errorf("expected %d settings, got %v", len(want), got)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile_Errors(t *testing.T) {
+	tests := map[string]string{
+		"config.json": `{}`,
+		"config.yaml": "request_timeout: [unclosed",
+		"nested.yaml": "cors:\n  allowed_origins:\n    - {origin: x}\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readConfigFile(writeFile(t, name, content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if _, err := readConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
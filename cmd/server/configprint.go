@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+
+	"github.com/mstephenholl/gitops-demo/internal/handlers"
+)
+
+// configReport is the effective configuration as shown by /debug/config and
+// config print. Secret values are already redacted in the settings it is
+// built from.
+type configReport struct {
+	AppEnv     string          `json:"app_env"`
+	EnvFiles   []string        `json:"env_files"`
+	ConfigFile string          `json:"config_file,omitempty"`
+	Settings   []reportSetting `json:"settings"`
+}
+
+type reportSetting struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"`
+	// Changed reports whether the value differs from the default.
+	Changed bool `json:"changed"`
+	Secret  bool `json:"secret,omitempty"`
+}
+
+func newConfigReport(cfg config) configReport {
+	r := configReport{
+		AppEnv:     cfg.AppEnv,
+		EnvFiles:   cfg.EnvFiles,
+		ConfigFile: cfg.ConfigFile,
+		Settings:   make([]reportSetting, len(cfg.settings)),
+	}
+	if r.EnvFiles == nil {
+		r.EnvFiles = []string{}
+	}
+	for i, s := range cfg.settings {
+		r.Settings[i] = reportSetting{
+			Key:     s.Key,
+			Value:   s.Value,
+			Default: s.Default,
+			Source:  s.Source,
+			Changed: s.Value != s.Default,
+			Secret:  s.Secret,
+		}
+	}
+	return r
+}
+
+// write renders the report as json or text.
+func (r configReport) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "text":
+		return r.writeText(w)
+	default:
+		return fmt.Errorf("unknown format %q: want json or text", format)
+	}
+}
+
+// writeText writes one aligned line per setting, marking those that differ
+// from their default with '*'.
+func (r configReport) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "# app_env: %s\n", r.AppEnv)
+	fmt.Fprintf(tw, "# env_files: %v\n", r.EnvFiles)
+	if r.ConfigFile != "" {
+		fmt.Fprintf(tw, "# config_file: %s\n", r.ConfigFile)
+	}
+	fmt.Fprintln(tw, "\tKEY\tVALUE\tSOURCE\tDEFAULT")
+	for _, s := range r.Settings {
+		mark := ""
+		if s.Changed {
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", mark, s.Key, s.Value, s.Source, s.Default)
+	}
+	return tw.Flush()
+}
+
+// configHandler serves the effective configuration, as JSON or, with
+// ?format=text, as a table.
+func configHandler(live *liveConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			format = "json"
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(handlers.ErrorResponse{Error: "format must be json or text"})
+			return
+		}
+		_ = newConfigReport(live.Load()).write(w, format)
+	}
+}
+
+// runConfig implements the config subcommand:
+//
+//	server config print [-format text|json]
+//
+// It resolves the configuration exactly as the server would at startup and
+// prints it without starting the server.
+func runConfig(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: server config print [-format text|json]")
+	}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	format := fs.String("format", "text", "output format, text or json")
+	if err := fs.Parse(args[1:]); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	return newConfigReport(cfg).write(stdout, *format)
+}
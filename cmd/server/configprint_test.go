@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mstephenholl/gitops-demo/internal/lifecycle"
+)
+
+// reportSettingFor returns the report entry for key.
+func reportSettingFor(t *testing.T, r configReport, key string) reportSetting {
+	t.Helper()
+	for _, s := range r.Settings {
+		if s.Key == key {
+			return s
+		}
+	}
+	t.Fatalf("no setting %s in report", key)
+	return reportSetting{}
+}
+
+func TestNewConfigReport(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("API_KEYS", "dash:s3cret")
+
+	r := newConfigReport(testConfig(t))
+
+	if s := reportSettingFor(t, r, "PORT"); s.Value != "9090" || s.Source != "env" || s.Default != "8080" || !s.Changed {
+		t.Errorf("unexpected PORT entry: %+v", s)
+	}
+	if s := reportSettingFor(t, r, "REQUEST_TIMEOUT"); s.Source != "default" || s.Changed {
+		t.Errorf("unexpected REQUEST_TIMEOUT entry: %+v", s)
+	}
+	if s := reportSettingFor(t, r, "API_KEYS"); s.Value != redacted || !s.Secret || !s.Changed {
+		t.Errorf("unexpected API_KEYS entry: %+v", s)
+	}
+}
+
+func TestConfigReport_Text(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("API_KEYS", "dash:s3cret")
+
+	var buf bytes.Buffer
+	if err := newConfigReport(testConfig(t)).write(&buf, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("expected secrets to be redacted, got:\n%s", out)
+	}
+	for _, want := range []string{"# app_env: prod", "KEY", "SOURCE"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[1] {
+		case "PORT", "API_KEYS":
+			if fields[0] != "*" {
+				t.Errorf("expected %s to be marked as changed, got %q", fields[1], line)
+			}
+		}
+		if fields[0] == "REQUEST_TIMEOUT" && fields[1] != "10s" {
+			t.Errorf("expected REQUEST_TIMEOUT unmarked at 10s, got %q", line)
+		}
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret")
+	h := configHandler(newLiveConfig(testConfig(t)))
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected JSON 200, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(rec.Body.String(), "s3cret") {
+		t.Errorf("expected secrets to be redacted, got:\n%s", rec.Body.String())
+	}
+	var r configReport
+	if err := json.NewDecoder(rec.Body).Decode(&r); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if r.AppEnv != "prod" || len(r.Settings) == 0 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/debug/config?format=text", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") || !strings.Contains(rec.Body.String(), "REQUEST_TIMEOUT") {
+		t.Errorf("expected a text table, got %q:\n%s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/debug/config?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
+func TestNewRouter_DebugConfigRoute(t *testing.T) {
+	t.Setenv("API_KEYS", "ops:0ps:debug")
+	t.Setenv("DEBUG_ROUTES_ENABLED", "true")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), authn)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+	req.Header.Set("Authorization", "Bearer 0ps")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	t.Setenv("PORT", "9090")
+
+	var buf bytes.Buffer
+	if err := runConfig([]string{"print", "-format", "json"}, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var r configReport
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	if s := reportSettingFor(t, r, "PORT"); s.Value != "9090" {
+		t.Errorf("expected PORT 9090, got %q", s.Value)
+	}
+
+	for _, args := range [][]string{nil, {"show"}, {"print", "-format", "yaml"}} {
+		if err := runConfig(args, &buf); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
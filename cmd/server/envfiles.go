@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/joho/godotenv"
+)
+
+// profiles are the defaults each APP_ENV applies beneath every other
+// source. The built-in defaults are the prod values.
+var profiles = map[string]map[string]string{
+	"dev": {
+		"LOG_FORMAT":           "text",
+		"LOG_LEVEL":            "debug",
+		"DEBUG_ROUTES_ENABLED": "true",
+	},
+	"staging": {
+		"DEBUG_ROUTES_ENABLED": "true",
+	},
+	"prod": {},
+}
+
+// defaultAppEnv is the profile used when APP_ENV is unset.
+const defaultAppEnv = "prod"
+
+// readEnvFiles reads the dotenv files in the working directory that layer
+// under env, highest precedence first: .env.local, .env.<APP_ENV> and .env.
+// APP_ENV is taken from env, .env.local or .env, in that order; the returned
+// setting records where it came from. Missing files are skipped; a file
+// that cannot be parsed is an error rather than being silently ignored.
+func readEnvFiles(env source) ([]source, setting, error) {
+	local, err := readEnvFile(".env.local")
+	if err != nil {
+		return nil, setting{}, err
+	}
+	base, err := readEnvFile(".env")
+	if err != nil {
+		return nil, setting{}, err
+	}
+
+	appEnv := setting{Key: "APP_ENV", Value: defaultAppEnv, Default: defaultAppEnv, Source: "default"}
+	if v, src, ok := lookupFirst("APP_ENV", env, local, base); ok {
+		appEnv.Value, appEnv.Source = v, src
+	}
+	if _, ok := profiles[appEnv.Value]; !ok {
+		return nil, setting{}, fmt.Errorf("invalid APP_ENV %q: want dev, staging or prod", appEnv.Value)
+	}
+
+	named, err := readEnvFile(".env." + appEnv.Value)
+	if err != nil {
+		return nil, setting{}, err
+	}
+
+	var files []source
+	for _, src := range []source{local, named, base} {
+		if src.lookup != nil {
+			files = append(files, src)
+		}
+	}
+	return files, appEnv, nil
+}
+
+// readEnvFile reads a dotenv file into a source named after it. A missing
+// file yields a source with a nil lookup.
+func readEnvFile(path string) (source, error) {
+	values, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return source{name: path}, nil
+	}
+	if err != nil {
+		return source{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	return source{name: path, lookup: mapLookup(values)}, nil
+}
+
+// profileSource returns the defaults of the named profile as a source.
+func profileSource(name string) source {
+	return source{name: "profile " + name, lookup: mapLookup(profiles[name])}
+}
+
+// lookupFirst returns the first non-empty value of key in sources and the
+// name of the source that set it.
+func lookupFirst(key string, sources ...source) (string, string, bool) {
+	for _, src := range sources {
+		if src.lookup == nil {
+			continue
+		}
+		if v, ok := src.lookup(key); ok && v != "" {
+			return v, src.name, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeEnvFile writes a dotenv file into the working directory.
+func writeEnvFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig_EnvFilePrecedence(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeEnvFile(t, ".env", "APP_ENV=staging\nPORT=1000\nREQUEST_TIMEOUT=1s\nPROBE_TIMEOUT=1s\nMAX_BODY_BYTES=1000\n")
+	writeEnvFile(t, ".env.staging", "PORT=2000\nREQUEST_TIMEOUT=2s\nPROBE_TIMEOUT=2s\n")
+	writeEnvFile(t, ".env.local", "PORT=3000\nREQUEST_TIMEOUT=3s\n")
+	writeEnvFile(t, ".env.dev", "PORT=9999\n")
+	t.Setenv("PORT", "4000")
+
+	cfg := testConfig(t)
+
+	if cfg.AppEnv != "staging" {
+		t.Errorf("expected APP_ENV staging from .env, got %q", cfg.AppEnv)
+	}
+	if want := []string{".env.local", ".env.staging", ".env"}; !slices.Equal(cfg.EnvFiles, want) {
+		t.Errorf("expected env files %v, got %v", want, cfg.EnvFiles)
+	}
+	for key, want := range map[string]string{
+		"APP_ENV":         ".env",
+		"PORT":            "env",
+		"REQUEST_TIMEOUT": ".env.local",
+		"PROBE_TIMEOUT":   ".env.staging",
+		"MAX_BODY_BYTES":  ".env",
+	} {
+		if got := cfg.setting(key).Source; got != want {
+			t.Errorf("expected %s from %s, got %s", key, want, got)
+		}
+	}
+	if cfg.Port != "4000" || cfg.RequestTimeout != 3*time.Second || cfg.ProbeTimeout != 2*time.Second || cfg.MaxBodyBytes != 1000 {
+		t.Errorf("unexpected values: port %s, request timeout %v, probe timeout %v, max body %d",
+			cfg.Port, cfg.RequestTimeout, cfg.ProbeTimeout, cfg.MaxBodyBytes)
+	}
+}
+
+func TestLoadConfig_EnvFileUnderConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	path := writeFile(t, "config.yaml", "request_timeout: 5s\nprobe_timeout: 5s\n")
+	writeEnvFile(t, ".env", "CONFIG_FILE="+path+"\nREQUEST_TIMEOUT=3s\n")
+
+	cfg := testConfig(t)
+
+	if cfg.ConfigFile != path {
+		t.Errorf("expected CONFIG_FILE to be read from .env, got %q", cfg.ConfigFile)
+	}
+	if cfg.RequestTimeout != 3*time.Second {
+		t.Errorf("expected .env to override the config file, got %v", cfg.RequestTimeout)
+	}
+	if cfg.ProbeTimeout != 5*time.Second {
+		t.Errorf("expected PROBE_TIMEOUT from the config file, got %v", cfg.ProbeTimeout)
+	}
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	tests := []struct {
+		appEnv      string
+		format      string
+		level       slog.Level
+		debugRoutes bool
+	}{
+		{"", "json", slog.LevelInfo, false},
+		{"prod", "json", slog.LevelInfo, false},
+		{"staging", "json", slog.LevelInfo, true},
+		{"dev", "text", slog.LevelDebug, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.appEnv, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("APP_ENV", tt.appEnv)
+
+			cfg := testConfig(t)
+
+			if cfg.LogFormat != tt.format || cfg.LogLevel != tt.level || cfg.DebugRoutesEnabled != tt.debugRoutes {
+				t.Errorf("expected format %s, level %v, debug routes %v; got %s, %v, %v",
+					tt.format, tt.level, tt.debugRoutes, cfg.LogFormat, cfg.LogLevel, cfg.DebugRoutesEnabled)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ProfileUnderEnvFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeEnvFile(t, ".env.dev", "LOG_FORMAT=json\n")
+	t.Setenv("APP_ENV", "dev")
+
+	cfg := testConfig(t)
+
+	if cfg.LogFormat != "json" {
+		t.Errorf("expected .env.dev to override the dev profile, got %q", cfg.LogFormat)
+	}
+	if got := cfg.setting("LOG_LEVEL").Source; got != "profile dev" {
+		t.Errorf("expected LOG_LEVEL from the dev profile, got %s", got)
+	}
+}
+
+func TestLoadConfig_EnvFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		env     string
+		wantErr string
+	}{
+		{"malformed .env", map[string]string{".env": "PORT=8080\nnot a variable\n"}, "", "read .env"},
+		{"malformed .env.local", map[string]string{".env.local": "PORT='8080\n"}, "", "read .env.local"},
+		{"malformed profile file", map[string]string{".env.dev": "LOG_FORMAT text\n"}, "dev", "read .env.dev"},
+		{"unknown APP_ENV", nil, "qa", `invalid APP_ENV "qa"`},
+		{"invalid LOG_FORMAT", map[string]string{".env": "LOG_FORMAT=xml\n"}, "", "LOG_FORMAT must be json or text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for name, content := range tt.files {
+				writeEnvFile(t, name, content)
+			}
+			t.Setenv("APP_ENV", tt.env)
+
+			_, err := loadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,13 +14,33 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/joho/godotenv"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+	"github.com/mstephenholl/gitops-demo/internal/flags"
 	"github.com/mstephenholl/gitops-demo/internal/handlers"
+	"github.com/mstephenholl/gitops-demo/internal/instance"
+	"github.com/mstephenholl/gitops-demo/internal/lifecycle"
+	"github.com/mstephenholl/gitops-demo/internal/listener"
+	"github.com/mstephenholl/gitops-demo/internal/restart"
 	"github.com/mstephenholl/gitops-demo/internal/version"
 )
 
+// processStart is when this process started, reported by /info.
+var processStart = time.Now()
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	if err := start(); err != nil {
 		slog.Error("server exited with error", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -27,43 +48,249 @@ func main() {
 }
 
 func start() error {
-	// Load .env file if present; existing env vars take precedence.
-	_ = godotenv.Load()
+	// A process started by a graceful restart takes over its parent's
+	// listeners instead of opening its own.
+	child, err := restart.Inherit()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
 
-	logger := newLogger()
-	port := envOrDefault("PORT", "8080")
+	var level slog.LevelVar
+	level.Set(cfg.LogLevel)
+	logger := newLogger(cfg.LogFormat, &level, cfg.Instance)
+	live := newLiveConfig(cfg)
+	live.OnChange(func(c config) { level.Set(c.LogLevel) })
 
-	logStartup(logger, port)
+	logStartup(logger, cfg)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	srv := newServer(port, newRouter(logger))
+	app := lifecycle.New(logger)
+	authn, err := newAuthenticator(ctx, live, logger, app)
+	if err != nil {
+		return err
+	}
+	if authn == nil {
+		logger.Warn("no API keys or JWKS configured, all routes are unauthenticated")
+	}
+
+	reg := newMetricsRegistry()
+	conns := handlers.NewConnTracker(cfg.Connections, reg)
+	lc := handlers.NewLifecycle(processStart)
+	maint := handlers.NewMaintenance(logger, cfg.Maintenance)
+	live.OnChange(func(c config) { maint.SetConfig(c.Maintenance) })
+	inflight := handlers.NewInFlight()
+	srv := newServer(cfg.Port, conns.Middleware(newRouter(logger, live, lc, maint, inflight, reg, authn)))
+	srv.ConnState = conns.ConnState
+	srv.ConnContext = conns.ConnContext
+	srv.RegisterOnShutdown(func() { lc.Set(handlers.StateStopping) })
+
+	opts := listener.Options{SocketMode: cfg.UnixSocketMode}
+	if child != nil {
+		opts.Inherited = child.Listeners
+	}
+	lns, err := listener.Listen(cfg.Listen, opts)
+	if err != nil {
+		return fmt.Errorf("server listen: %w", err)
+	}
+	for _, ln := range lns {
+		logger.Info("listening",
+			slog.String("network", ln.Addr().Network()),
+			slog.String("addr", ln.Addr().String()),
+		)
+	}
+
+	ctx, drain := context.WithCancel(ctx)
+	defer drain()
+
+	// The watchers stop after the server so that reloads and maintenance
+	// switches keep working while it drains.
+	app.Add("config-watcher", lifecycle.Background(func(ctx context.Context) error {
+		watchConfig(ctx, logger, live, loadConfig)
+		return nil
+	}), lifecycle.Options{StopTimeout: time.Second})
+	addMaintenanceWatcher(app, logger, maint, cfg.MaintenanceFile)
+	if cfg.GracefulRestartEnabled {
+		app.Add("restart-watcher", lifecycle.Background(func(ctx context.Context) error {
+			watchRestart(ctx, drain, logger, lns, cfg.GracefulRestartTimeout)
+			return nil
+		}), lifecycle.Options{StopTimeout: time.Second})
+	}
+	app.Add("http-server", newHTTPServer(srv, logger, inflight, serveListeners(cfg, lns)...), lifecycle.Options{
+		DependsOn: []string{"config-watcher", "maintenance-watcher"},
+	})
+	app.Add("readiness", lifecycle.Hooks{OnStart: func(context.Context) error {
+		lc.Set(handlers.StateReady)
+		return nil
+	}}, lifecycle.Options{DependsOn: []string{"http-server"}})
+	// The previous process starts draining once told this one is ready, so
+	// that happens only when this one is serving.
+	if child != nil {
+		app.Add("restart-handover", lifecycle.Hooks{OnStart: func(context.Context) error {
+			if err := child.Ready(); err != nil {
+				return err
+			}
+			logger.Info("took over listeners from previous process")
+			return nil
+		}}, lifecycle.Options{DependsOn: []string{"readiness"}})
+	}
+
+	return run(drainFirst(ctx, logger, lc, cfg.ShutdownDrainDelay), logger, app)
+}
+
+// drainFirst returns a context that is done delay after ctx is done. In
+// between, lc is draining: the readiness probe fails so the pod leaves the
+// Service endpoints while it still serves the requests routed to it.
+func drainFirst(ctx context.Context, logger *slog.Logger, lc *handlers.Lifecycle, delay time.Duration) context.Context {
+	shutdown, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		<-ctx.Done()
+		lc.Set(handlers.StateDraining)
+		logger.Info("draining before shutdown", slog.Duration("delay", delay))
+		time.Sleep(delay)
+		cancel()
+	}()
+	return shutdown
+}
+
+// serveListeners returns the listeners to serve on, sharing the connection
+// limit and wrapped to parse PROXY protocol headers when those are enabled.
+func serveListeners(cfg config, lns []listener.Listener) []net.Listener {
+	var limit *listener.ConnLimit
+	if cfg.MaxConnections > 0 {
+		limit = listener.NewConnLimit(cfg.MaxConnections)
+	}
 
-	return run(ctx, srv, logger)
+	out := make([]net.Listener, len(lns))
+	for i, ln := range lns {
+		out[i] = ln
+		if limit != nil {
+			out[i] = limit.Listener(out[i])
+		}
+		if cfg.ProxyProtocolEnabled {
+			out[i] = listener.ProxyProtocol(out[i], cfg.ProxyProtocolTrusted, cfg.ProxyProtocolTimeout)
+		}
+	}
+	return out
 }
 
-// newLogger creates the default JSON logger for the application.
-func newLogger() *slog.Logger {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+// watchRestart hands lns to a new copy of the binary on SIGUSR2 and, once it
+// is ready, calls drain so that run shuts this process down. A failed
+// restart is logged and this process keeps serving.
+func watchRestart(ctx context.Context, drain context.CancelFunc, logger *slog.Logger, lns []listener.Listener, timeout time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
+
+		logger.Info("graceful restart requested")
+		proc, err := restart.Spawn(lns, timeout)
+		if err != nil {
+			logger.Error("graceful restart failed", slog.String("error", err.Error()))
+			continue
+		}
+		logger.Info("new process ready, draining", slog.Int("pid", proc.Pid))
+		drain()
+		return
+	}
+}
+
+// newLogger creates the default logger for the application, writing format
+// (json or text) and logging at level and above. Every record carries the
+// instance identity.
+func newLogger(format string, level slog.Leveler, inst instance.Info) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	logger := slog.New(handler).With(slog.Any("instance", inst))
 	slog.SetDefault(logger)
 	return logger
 }
 
-// logStartup logs the server configuration at startup.
-func logStartup(logger *slog.Logger, port string) {
+// logStartup logs the server configuration at startup: the build, the
+// profile and .env files in use, and the source of every setting that is
+// not at its default.
+func logStartup(logger *slog.Logger, cfg config) {
 	info := version.Get()
+
+	var sources []slog.Attr
+	for _, s := range cfg.settings {
+		if s.Source != "default" {
+			sources = append(sources, slog.String(s.Key, s.Source))
+		}
+	}
+
 	logger.Info("starting server",
-		slog.String("port", port),
+		slog.String("port", cfg.Port),
 		slog.String("tag", info.Tag),
 		slog.String("commit", info.Commit),
 		slog.String("build_time", info.BuildTime),
+		slog.String("app_env", cfg.AppEnv),
+		slog.String("config_hash", cfg.fingerprint()),
+		slog.Any("env_files", cfg.EnvFiles),
+		slog.String("config_file", cfg.ConfigFile),
+		slog.Any("sources", slog.GroupValue(sources...)),
+	)
+}
+
+// newAuthenticator builds the authenticator for the configured credential
+// sources, or returns nil when none are configured. The JWKS is loaded
+// before returning, within ctx, and then refreshed by a jwks-refresh
+// component added to app. API keys follow reloads of live, so rotated
+// secrets take effect without a restart.
+func newAuthenticator(ctx context.Context, live *liveConfig, logger *slog.Logger, app *lifecycle.Manager) (auth.Authenticator, error) {
+	cfg := live.Load()
+	if !cfg.authEnabled {
+		return nil, nil
+	}
+
+	var chain auth.Chain
+	if cfg.JWKS != "" {
+		keys := auth.NewKeySet(cfg.JWKS, nil)
+		if err := keys.Refresh(ctx); err != nil {
+			return nil, fmt.Errorf("load JWKS: %w", err)
+		}
+		app.Add("jwks-refresh", lifecycle.Background(func(ctx context.Context) error {
+			keys.Run(ctx, cfg.JWKSRefresh, logger)
+			return nil
+		}), lifecycle.Options{StopTimeout: time.Second})
+		chain = append(chain, auth.NewJWTAuthenticator(keys, cfg.JWT))
+	}
+	// API keys are accepted alongside JWTs even when there are none yet, so
+	// that keys added by a reload take effect.
+	keys := auth.NewStaticKeys(cfg.APIKeys)
+	live.OnChange(func(c config) { keys.Replace(c.APIKeys) })
+	return append(chain, keys), nil
+}
+
+// newMetricsRegistry creates the Prometheus registry served at /metrics,
+// pre-populated with the standard Go runtime and process collectors.
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
+	return reg
 }
 
-// newServer creates a configured *http.Server.
+// newServer creates a configured *http.Server. WriteTimeout is only a
+// backstop: per-route deadlines are enforced by handlers.Timeout, which
+// returns a proper error response instead of truncating the connection.
 func newServer(port string, handler http.Handler) *http.Server {
 	return &http.Server{
 		Addr:              fmt.Sprintf(":%s", port),
@@ -76,52 +303,280 @@ func newServer(port string, handler http.Handler) *http.Server {
 }
 
 // newRouter builds and returns the Chi router with all routes and middleware.
-func newRouter(logger *slog.Logger) *chi.Mux {
+// Timeouts and concurrency limits follow reloads of live; everything else is
+// fixed when the router is built. Feature flags follow reloads too, and
+// keep their runtime overrides. The readiness probe and /info follow lc,
+// and a nil lc is always ready. API routes are turned away while maint is
+// in maintenance mode; a nil maint never is. Requests are registered in
+// inflight, which may be nil. A nil authn leaves every route
+// unauthenticated and the debug routes unmounted.
+func newRouter(logger *slog.Logger, live *liveConfig, lc *handlers.Lifecycle, maint *handlers.Maintenance, inflight *handlers.InFlight, reg *prometheus.Registry, authn auth.Authenticator) *chi.Mux {
+	cfg := live.Load()
 	r := chi.NewRouter()
 
+	set := flags.NewSet(logger, cfg.Flags)
+	live.OnChange(func(c config) { set.Replace(c.Flags) })
+
+	// RealIP runs first so that everything after it, including the request
+	// log, sees the resolved client address.
+	r.Use(handlers.RealIP(cfg.TrustedProxies))
+	r.Use(handlers.RequestID)
 	r.Use(handlers.RequestLogger(logger))
+	if inflight != nil {
+		r.Use(inflight.Middleware)
+	}
+	r.Use(handlers.ServedBy(cfg.Instance.Name()))
+	if cfg.SecurityHeadersEnabled {
+		r.Use(handlers.SecurityHeaders(cfg.SecurityHeaders))
+	}
+	if cfg.CompressionEnabled {
+		r.Use(handlers.Compress(cfg.Compression))
+	}
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		r.Use(handlers.CORS(cfg.CORS))
+	}
+
+	// Probes are always open so kubelet can reach them.
+	r.Group(func(r chi.Router) {
+		r.Use(recordRoute)
+		r.Use(handlers.TimeoutFunc(func() time.Duration { return live.Load().ProbeTimeout }))
+
+		r.Get("/healthz", handlers.Healthz(logger))
+		r.Get("/readyz", handlers.Readyz(logger, lc))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(recordRoute)
+		r.Use(handlers.TimeoutFunc(func() time.Duration { return live.Load().RequestTimeout }))
+		if authn != nil {
+			r.Use(handlers.Authenticate(logger, authn))
+			r.Use(handlers.RequireAuth())
+		}
+
+		// Probes and metrics bypass the concurrency limiter so that an
+		// overloaded pod is shed by the Service rather than restarted.
+		r.Method(http.MethodGet, "/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+		var limit []func(http.Handler) http.Handler
+		if cfg.ConcurrencyLimitEnabled {
+			limiter := handlers.NewConcurrencyLimiter(cfg.ConcurrencyLimit, reg)
+			live.OnChange(func(c config) { limiter.SetConfig(c.ConcurrencyLimit) })
+			limit = append(limit, limiter.Middleware)
+		}
+
+		// /info reports maintenance mode, so it is served while that turns
+		// the API routes away, but it is limited like them.
+		r.With(limit...).Get("/info", handlers.Info(logger, func() handlers.ServerInfo {
+			cfg := live.Load()
+			info := handlers.ServerInfo{
+				Environment: cfg.AppEnv,
+				ConfigHash:  cfg.fingerprint(),
+				LastReload:  live.LastReload(),
+				StartTime:   processStart,
+				Instance:    cfg.Instance,
+			}
+			if lc != nil {
+				rd := lc.Readiness()
+				info.State, _ = lc.State()
+				info.Uptime = lc.Uptime().Truncate(time.Second).String()
+				info.Readiness = &rd
+			}
+			if maint != nil {
+				st := maint.Status()
+				info.Maintenance = &st
+			}
+			return info
+		}))
 
-	r.Get("/healthz", handlers.Healthz(logger))
-	r.Get("/readyz", handlers.Readyz(logger))
-	r.Get("/info", handlers.Info(logger))
+		// API routes speak JSON. A route can replace the body limit, to
+		// accept larger uploads or fewer bytes, with
+		// r.With(handlers.MaxBodySize(n)).
+		r.Group(func(r chi.Router) {
+			if maint != nil {
+				r.Use(maint.Middleware)
+			}
+			r.Use(limit...)
+			r.Use(handlers.MaxBodySize(cfg.MaxBodyBytes))
+			r.Use(handlers.RequireContentType("application/json"))
+			r.Use(handlers.FeatureFlags(set))
+
+			// Any caller may list the flags. Overrides change behaviour for
+			// everyone, so they need the admin scope and are not offered
+			// without authentication.
+			r.Get("/flags", handlers.ListFlags(set))
+			if authn != nil {
+				r.With(handlers.RequireAuth("admin")).Put("/flags/{name}", handlers.OverrideFlag(set))
+				r.With(handlers.RequireAuth("admin")).Delete("/flags/{name}", handlers.ClearFlagOverride(set))
+			}
+		})
+
+		// Admin switches stay reachable while maintenance mode turns the
+		// API routes away.
+		if authn != nil {
+			r.Group(func(r chi.Router) {
+				r.Use(handlers.RequireAuth("admin"))
+				r.Use(handlers.MaxBodySize(cfg.MaxBodyBytes))
+				r.Use(handlers.RequireContentType("application/json"))
+
+				if maint != nil {
+					r.Put("/maintenance", handlers.EnableMaintenance(maint))
+					r.Delete("/maintenance", handlers.DisableMaintenance(maint))
+				}
+				if lc != nil {
+					r.Put("/readiness", handlers.OverrideReadiness(logger, lc))
+					r.Delete("/readiness", handlers.ClearReadinessOverride(logger, lc))
+				}
+			})
+		}
+	})
+
+	// Debug routes skip the request timeout, since a CPU profile runs for
+	// as long as the caller asks, and need the debug scope. They expose
+	// configuration and profiles, so without authentication they are not
+	// served at all.
+	if cfg.DebugRoutesEnabled && authn == nil {
+		logger.Warn("debug routes need authentication, not serving them")
+	}
+	if cfg.DebugRoutesEnabled && authn != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(recordRoute)
+			r.Use(handlers.Authenticate(logger, authn))
+			r.Use(handlers.RequireAuth("debug"))
+
+			r.Get("/debug/config", configHandler(live))
+			if inflight != nil {
+				r.Get("/debug/requests", handlers.ActiveRequests(inflight))
+			}
+			r.Mount("/debug", middleware.Profiler())
+		})
+	}
 
 	return r
 }
 
-// run starts the HTTP server and performs graceful shutdown when ctx is cancelled.
-// It returns nil on clean shutdown, or an error if shutdown fails.
-func run(ctx context.Context, srv *http.Server, logger *slog.Logger) error {
-	errCh := make(chan error, 1)
-	go func() {
-		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			errCh <- err
-		}
-		close(errCh)
-	}()
+// recordRoute records the route chi matched on the in-flight request. It
+// must be used within a route group, which runs once routing is done.
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.SetRoute(r.Context(), chi.RouteContext(r.Context()).RoutePattern())
+		next.ServeHTTP(w, r)
+	})
+}
 
-	select {
-	case <-ctx.Done():
+// shutdownTimeout is the overall deadline for stopping the application
+// once shutdown begins.
+const shutdownTimeout = 15 * time.Second
+
+// run starts app and stops it again, within shutdownTimeout, when ctx is
+// cancelled or a component fails. It returns nil on clean shutdown, or an
+// error naming the components that failed or did not stop cleanly.
+func run(ctx context.Context, logger *slog.Logger, app *lifecycle.Manager) error {
+	if err := app.Start(ctx); err != nil {
+		return err
+	}
+
+	err := app.Wait(ctx)
+	if err != nil {
+		logger.Error("component failed, shutting down", slog.String("error", err.Error()))
+	} else {
 		logger.Info("shutdown signal received")
-	case err, ok := <-errCh:
-		if ok && err != nil {
-			return fmt.Errorf("server listen: %w", err)
-		}
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		return fmt.Errorf("graceful shutdown: %w", err)
+	report := app.Stop(shutdownCtx)
+	if stopErr := report.Err(); stopErr != nil {
+		logger.Error("shutdown incomplete", slog.Any("failed", report.Failed()))
+		return errors.Join(err, fmt.Errorf("graceful shutdown: %w", stopErr))
+	}
+	if err != nil {
+		return err
 	}
 
 	logger.Info("server stopped gracefully")
 	return nil
 }
 
-func envOrDefault(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// closeTimeout is the part of the shutdown deadline the server keeps back
+// to log the requests it could not drain and close their connections.
+const closeTimeout = time.Second
+
+// httpServer is the lifecycle component serving srv. It accepts on lns, or
+// on its own TCP listener for srv.Addr when none are given. Requests still
+// in inflight, which may be nil, when shutdown times out are logged.
+type httpServer struct {
+	srv          *http.Server
+	logger       *slog.Logger
+	inflight     *handlers.InFlight
+	lns          []net.Listener
+	failed       chan error
+	closeTimeout time.Duration
+}
+
+func newHTTPServer(srv *http.Server, logger *slog.Logger, inflight *handlers.InFlight, lns ...net.Listener) *httpServer {
+	return &httpServer{
+		srv:          srv,
+		logger:       logger,
+		inflight:     inflight,
+		lns:          lns,
+		failed:       make(chan error, 1),
+		closeTimeout: closeTimeout,
+	}
+}
+
+// Start opens the listener if there is none yet, so that an unusable
+// address fails the start, and serves in the background.
+func (s *httpServer) Start(context.Context) error {
+	if len(s.lns) == 0 {
+		ln, err := net.Listen("tcp", s.srv.Addr)
+		if err != nil {
+			return fmt.Errorf("server listen: %w", err)
+		}
+		s.lns = []net.Listener{ln}
+	}
+	for _, ln := range s.lns {
+		go func() {
+			if err := s.srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				select {
+				case s.failed <- fmt.Errorf("server listen: %w", err):
+				default:
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Failed reports the first listener that stops serving.
+func (s *httpServer) Failed() <-chan error {
+	return s.failed
+}
+
+// Stop closes the listeners and waits for in-flight requests to finish. If
+// they are still running closeTimeout before ctx's deadline, or when ctx is
+// cancelled, it logs them and closes their connections. Keeping that time
+// back lets it finish before the lifecycle manager gives up on it at the
+// deadline.
+func (s *httpServer) Stop(ctx context.Context) error {
+	shutdownCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithDeadline(ctx, deadline.Add(-s.closeTimeout))
+		defer cancel()
+	}
+
+	err := s.srv.Shutdown(shutdownCtx)
+	if err == nil {
+		return nil
+	}
+	if s.inflight != nil {
+		active := s.inflight.List()
+		s.logger.Warn("shutdown deadline reached, closing active requests", slog.Int("count", len(active)))
+		for _, req := range active {
+			s.logger.Warn("request still active at shutdown", slog.Any("request", req))
+		}
 	}
-	return fallback
+	_ = s.srv.Close()
+	return err
 }
@@ -1,27 +1,49 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/mstephenholl/gitops-demo/internal/version"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mstephenholl/gitops-demo/internal/handlers"
+	"github.com/mstephenholl/gitops-demo/internal/instance"
+	"github.com/mstephenholl/gitops-demo/internal/lifecycle"
+	"github.com/mstephenholl/gitops-demo/internal/listener"
 )
 
 func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(&discardWriter{}, nil))
 }
 
+// testConfig returns the configuration resolved from defaults.
+func testConfig(t *testing.T) config {
+	t.Helper()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return cfg
+}
+
 type discardWriter struct{}
 
 func (d *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
 
 func TestNewRouter_HealthzRoute(t *testing.T) {
-	r := newRouter(testLogger())
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
 	srv := httptest.NewServer(r)
 	defer srv.Close()
 
@@ -37,7 +59,7 @@ func TestNewRouter_HealthzRoute(t *testing.T) {
 }
 
 func TestNewRouter_ReadyzRoute(t *testing.T) {
-	r := newRouter(testLogger())
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
 	srv := httptest.NewServer(r)
 	defer srv.Close()
 
@@ -53,7 +75,8 @@ func TestNewRouter_ReadyzRoute(t *testing.T) {
 }
 
 func TestNewRouter_InfoRoute(t *testing.T) {
-	r := newRouter(testLogger())
+	cfg := testConfig(t)
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), nil)
 	srv := httptest.NewServer(r)
 	defer srv.Close()
 
@@ -67,7 +90,7 @@ func TestNewRouter_InfoRoute(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
 	}
 
-	var info version.Info
+	var info handlers.ServerInfo
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
@@ -75,10 +98,149 @@ func TestNewRouter_InfoRoute(t *testing.T) {
 	if info.Tag == "" {
 		t.Error("expected Tag to be non-empty")
 	}
+	if info.Environment != "prod" {
+		t.Errorf("expected environment prod, got %q", info.Environment)
+	}
+	if info.ConfigHash != cfg.fingerprint() {
+		t.Errorf("expected config hash %s, got %q", cfg.fingerprint(), info.ConfigHash)
+	}
+	if !info.StartTime.Equal(processStart) {
+		t.Errorf("expected start time %v, got %v", processStart, info.StartTime)
+	}
+}
+
+func TestNewRouter_InstanceIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "gitops-demo-7d9f-abcde")
+	t.Setenv("POD_NAMESPACE", "gitops-demo")
+	t.Setenv("NODE_NAME", "k3d-agent-0")
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+
+	if got := rec.Header().Get("X-Served-By"); got != "gitops-demo/gitops-demo-7d9f-abcde" {
+		t.Errorf("expected X-Served-By to name the pod, got %q", got)
+	}
+	var info handlers.ServerInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Instance.Pod != "gitops-demo-7d9f-abcde" || info.Instance.Node != "k3d-agent-0" {
+		t.Errorf("expected the instance in /info, got %+v", info.Instance)
+	}
+}
+
+func TestNewRouter_InfoLifecycle(t *testing.T) {
+	live := newLiveConfig(testConfig(t))
+	lc := handlers.NewLifecycle(processStart)
+	lc.Set(handlers.StateDraining)
+	r := newRouter(testLogger(), live, lc, nil, nil, prometheus.NewRegistry(), nil)
+
+	getInfo := func() handlers.ServerInfo {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+		var info handlers.ServerInfo
+		if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return info
+	}
+
+	info := getInfo()
+	if info.State != handlers.StateDraining {
+		t.Errorf("expected state draining, got %q", info.State)
+	}
+	if info.Readiness == nil || info.Readiness.Ready || info.Readiness.Reason != "draining" {
+		t.Errorf("expected not ready because draining, got %+v", info.Readiness)
+	}
+	if _, err := time.ParseDuration(info.Uptime); err != nil {
+		t.Errorf("expected a duration uptime, got %q", info.Uptime)
+	}
+	if !info.LastReload.IsZero() {
+		t.Errorf("expected no reload yet, got %v", info.LastReload)
+	}
+
+	live.Store(live.Load())
+	if info := getInfo(); info.LastReload.IsZero() {
+		t.Error("expected the reload time after a reload")
+	}
+}
+
+func TestDrainFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lc := handlers.NewLifecycle(time.Now())
+	lc.Set(handlers.StateReady)
+
+	shutdown := drainFirst(ctx, testLogger(), lc, 100*time.Millisecond)
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lc.Readiness().Ready {
+		if time.Now().After(deadline) {
+			t.Fatal("lifecycle never started draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if shutdown.Err() != nil {
+		t.Error("expected shutdown to wait for the drain delay")
+	}
+	select {
+	case <-shutdown.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown never started")
+	}
+}
+
+func TestNewRouter_ReadinessOverride(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret,ops:0ps:admin")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	lc := handlers.NewLifecycle(processStart)
+	lc.Set(handlers.StateReady)
+	r := newRouter(testLogger(), newLiveConfig(cfg), lc, nil, nil, prometheus.NewRegistry(), authn)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"reason":"debugging","expires_in":"15m"}`
+	if rec := do(http.MethodPut, "/readiness", "s3cret", body); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the override to need the admin scope, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/readiness", "0ps", body); rec.Code != http.StatusOK {
+		t.Fatalf("expected the override to be set, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/readyz", "", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz to fail under the override, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/healthz", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected healthz to pass under the override, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/info", "s3cret", ""); !strings.Contains(rec.Body.String(), `"override":{"reason":"debugging","by":"ops"`) {
+		t.Errorf("expected /info to show the override, got %s", rec.Body.String())
+	}
+
+	if rec := do(http.MethodDelete, "/readiness", "0ps", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the override to be cleared, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/readyz", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected readyz to pass again, got %d", rec.Code)
+	}
 }
 
 func TestNewRouter_NotFound(t *testing.T) {
-	r := newRouter(testLogger())
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
 	srv := httptest.NewServer(r)
 	defer srv.Close()
 
@@ -93,22 +255,6 @@ func TestNewRouter_NotFound(t *testing.T) {
 	}
 }
 
-func TestEnvOrDefault_UsesDefault(t *testing.T) {
-	val := envOrDefault("GITOPS_DEMO_NONEXISTENT_KEY_12345", "fallback")
-	if val != "fallback" {
-		t.Errorf("expected %q, got %q", "fallback", val)
-	}
-}
-
-func TestEnvOrDefault_UsesEnv(t *testing.T) {
-	t.Setenv("GITOPS_DEMO_TEST_KEY", "from_env")
-
-	val := envOrDefault("GITOPS_DEMO_TEST_KEY", "fallback")
-	if val != "from_env" {
-		t.Errorf("expected %q, got %q", "from_env", val)
-	}
-}
-
 func TestNewServer_Configuration(t *testing.T) {
 	handler := http.NewServeMux()
 	srv := newServer("9090", handler)
@@ -134,26 +280,59 @@ func TestNewServer_Configuration(t *testing.T) {
 }
 
 func TestNewLogger_ReturnsNonNil(t *testing.T) {
-	logger := newLogger()
+	logger := newLogger("json", slog.LevelInfo, instance.Info{})
 	if logger == nil {
 		t.Fatal("expected non-nil logger")
 	}
 }
 
-func TestLogStartup_DoesNotPanic(t *testing.T) {
-	logger := testLogger()
-	logStartup(logger, "8080")
+func TestNewLogger_TextFormat(t *testing.T) {
+	logger := newLogger("text", slog.LevelInfo, instance.Info{})
+	if _, ok := logger.Handler().(*slog.TextHandler); !ok {
+		t.Errorf("expected a text handler, got %T", logger.Handler())
+	}
+}
+
+func TestLogStartup_ReportsSources(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeEnvFile(t, ".env", "REQUEST_TIMEOUT=3s\n")
+	t.Setenv("PORT", "9090")
+
+	var buf bytes.Buffer
+	logStartup(slog.New(slog.NewTextHandler(&buf, nil)), testConfig(t))
+
+	out := buf.String()
+	for _, want := range []string{
+		"app_env=prod",
+		"env_files=[.env]",
+		"sources.PORT=env",
+		"sources.REQUEST_TIMEOUT=.env",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected startup log to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sources.PROBE_TIMEOUT") {
+		t.Errorf("expected defaults to be left out, got:\n%s", out)
+	}
+}
+
+// runServer runs srv as the only component of the application.
+func runServer(ctx context.Context, srv *http.Server, logger *slog.Logger, lns ...net.Listener) error {
+	app := lifecycle.New(logger)
+	app.Add("http-server", newHTTPServer(srv, logger, nil, lns...), lifecycle.Options{})
+	return run(ctx, logger, app)
 }
 
 func TestRun_GracefulShutdown(t *testing.T) {
 	logger := testLogger()
-	srv := newServer("0", newRouter(logger)) // port 0 = random available port
+	srv := newServer("0", newRouter(logger, newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)) // port 0 = random available port
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- run(ctx, srv, logger)
+		errCh <- runServer(ctx, srv, logger)
 	}()
 
 	// Give the server a moment to start
@@ -172,6 +351,126 @@ func TestRun_GracefulShutdown(t *testing.T) {
 	}
 }
 
+func TestRun_ReportsComponentFailures(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	srv := newServer("0", http.NotFoundHandler())
+
+	app := lifecycle.New(logger)
+	app.Add("http-server", newHTTPServer(srv, logger, nil), lifecycle.Options{})
+	app.Add("worker", lifecycle.Background(func(context.Context) error {
+		return errors.New("queue closed")
+	}), lifecycle.Options{})
+	app.Add("stuck", lifecycle.Hooks{OnStop: func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}, lifecycle.Options{StopTimeout: 20 * time.Millisecond})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- run(context.Background(), logger, app) }()
+
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "worker: queue closed") || !strings.Contains(err.Error(), "stuck: did not stop in time") {
+			t.Errorf("expected the worker failure and the stuck component, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after a component failed")
+	}
+	if out := buf.String(); !strings.Contains(out, "shutdown incomplete") || !strings.Contains(out, "failed=[stuck]") {
+		t.Errorf("expected the incomplete shutdown to be logged, got:\n%s", out)
+	}
+}
+
+func TestNewRouter_DebugRequests(t *testing.T) {
+	t.Setenv("API_KEYS", "ops:0ps:debug")
+	t.Setenv("DEBUG_ROUTES_ENABLED", "true")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	inflight := handlers.NewInFlight()
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, inflight, prometheus.NewRegistry(), authn)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/requests", nil)
+	req.Header.Set("Authorization", "Bearer 0ps")
+	req.Header.Set(handlers.RequestIDHeader, "trace-42")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var active []handlers.ActiveRequest
+	if err := json.NewDecoder(rec.Body).Decode(&active); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != "trace-42" || active[0].Route != "/debug/requests" {
+		t.Errorf("expected the listing request itself, got %+v", active)
+	}
+	if rec.Header().Get(handlers.RequestIDHeader) != "trace-42" {
+		t.Errorf("expected the request ID to be echoed, got %q", rec.Header().Get(handlers.RequestIDHeader))
+	}
+}
+
+func TestHTTPServer_LogsActiveRequestsAtDeadline(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	inflight := handlers.NewInFlight()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	r := chi.NewRouter()
+	r.Use(handlers.RequestID, inflight.Middleware)
+	r.Group(func(r chi.Router) {
+		r.Use(recordRoute)
+		r.Get("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+		})
+	})
+
+	srv := newServer("0", r)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newHTTPServer(srv, logger, inflight, ln)
+	s.closeTimeout = 100 * time.Millisecond
+	app := lifecycle.New(logger)
+	app.Add("http-server", s, lifecycle.Options{})
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/jobs/7", nil)
+		req.Header.Set(handlers.RequestIDHeader, "stuck-1")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	// The manager gives up on a component at the overall deadline, so the
+	// requests must be reported before then for the log to be complete.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	report := app.Stop(ctx)
+	if err := report.Err(); !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, lifecycle.ErrStopTimeout) {
+		t.Errorf("expected the server to stop itself at its deadline, got %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"shutdown deadline reached, closing active requests\" count=1",
+		`msg="request still active at shutdown" request.id=stuck-1 request.method=GET request.path=/jobs/7 request.route=/jobs/{id}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
 func TestStart_InvalidPort(t *testing.T) {
 	// Use an out-of-range port so ListenAndServe fails immediately,
 	// causing start() to return an error without blocking.
@@ -193,13 +492,480 @@ func TestRun_InvalidPort(t *testing.T) {
 	defer func() { _ = blocker.Close() }()
 
 	// Use a port that's definitely invalid
-	srv := newServer("99999", newRouter(logger))
+	srv := newServer("99999", newRouter(logger, newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := run(ctx, srv, logger)
+	err := runServer(ctx, srv, logger)
 	if err == nil {
 		t.Error("expected an error for invalid port, got nil")
 	}
 }
+
+func TestNewRouter_MetricsRoute(t *testing.T) {
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if !strings.Contains(string(body), "gitops_demo_concurrency_limit") {
+		t.Error("expected metrics to include gitops_demo_concurrency_limit")
+	}
+}
+
+func TestNewRouter_APIRejectsNonJSONBody(t *testing.T) {
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/flags", strings.NewReader("a=b"))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, resp.StatusCode)
+	}
+}
+
+func TestNewRouter_CORSPreflightAllRoutes(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://dash.example.com")
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		req := httptest.NewRequest(http.MethodOptions, route, nil)
+		req.Header.Set("Origin", "https://dash.example.com")
+		req.Header.Set("Access-Control-Request-Method", method)
+		rec := httptest.NewRecorder()
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s %s: expected preflight status %d, got %d", method, route, http.StatusNoContent, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+			t.Errorf("%s %s: expected Access-Control-Allow-Origin, got %q", method, route, got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+}
+
+func TestNewRouter_SecurityHeadersOnAllRoutes(t *testing.T) {
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+		"Cache-Control":           "no-store",
+	}
+
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, route, nil))
+
+		for k, v := range want {
+			if got := rec.Header().Get(k); got != v {
+				t.Errorf("%s %s: expected %s %q, got %q", method, route, k, v, got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+}
+
+func TestNewRouter_HSTSBehindTrustedProxy(t *testing.T) {
+	t.Setenv("TRUST_FORWARDED_PROTO", "true")
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.0/24") // httptest's default RemoteAddr
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("expected Strict-Transport-Security %q, got %q", "max-age=31536000", got)
+	}
+}
+
+func TestNewRouter_AuthPolicies(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), authn)
+
+	tests := []struct {
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{"/healthz", "", http.StatusOK},
+		{"/readyz", "", http.StatusOK},
+		{"/info", "", http.StatusUnauthorized},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/info", "s3cret", http.StatusOK},
+		{"/metrics", "s3cret", http.StatusOK},
+		{"/healthz", "wrong", http.StatusOK},
+		{"/info", "wrong", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s with key %q: expected status %d, got %d", tt.path, tt.key, tt.wantStatus, rec.Code)
+		}
+	}
+}
+
+func TestNewRouter_DebugRoutes(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret,ops:0ps:debug")
+	t.Setenv("DEBUG_ROUTES_ENABLED", "true")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), authn)
+
+	for key, want := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"s3cret": http.StatusForbidden,
+		"0ps":    http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("key %q: expected status %d, got %d", key, want, rec.Code)
+		}
+	}
+}
+
+func TestNewRouter_DebugRoutesNeedAuthentication(t *testing.T) {
+	t.Setenv("DEBUG_ROUTES_ENABLED", "true")
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	r := newRouter(logger, newLiveConfig(testConfig(t)), nil, nil, handlers.NewInFlight(), prometheus.NewRegistry(), nil)
+
+	for _, path := range []string{"/debug/config", "/debug/requests", "/debug/pprof/"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d without authentication, got %d", path, http.StatusNotFound, rec.Code)
+		}
+	}
+	if !strings.Contains(buf.String(), "debug routes need authentication") {
+		t.Errorf("expected a warning, got:\n%s", buf.String())
+	}
+}
+
+func TestNewRouter_FlagsRoutes(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret,ops:0ps:admin")
+	t.Setenv("FLAGS", "dark-mode=false")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), authn)
+
+	tests := []struct {
+		method     string
+		key        string
+		body       string
+		wantStatus int
+	}{
+		{http.MethodGet, "", "", http.StatusUnauthorized},
+		{http.MethodGet, "s3cret", "", http.StatusOK},
+		{http.MethodPut, "s3cret", `{"value":"true"}`, http.StatusForbidden},
+		{http.MethodPut, "0ps", `{"value":"true"}`, http.StatusOK},
+		{http.MethodDelete, "0ps", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		path := "/flags"
+		if tt.method != http.MethodGet {
+			path += "/dark-mode"
+		}
+		req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s %s with key %q: expected status %d, got %d", tt.method, path, tt.key, tt.wantStatus, rec.Code)
+		}
+	}
+}
+
+func TestNewRouter_FlagsReadOnlyWithoutAuth(t *testing.T) {
+	t.Setenv("FLAGS", "dark-mode=false")
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flags", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"dark-mode"`) {
+		t.Errorf("expected the flag list, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/flags/dark-mode", strings.NewReader(`{"value":"true"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed && rec.Code != http.StatusNotFound {
+		t.Errorf("expected overrides to be unavailable without authentication, got %d", rec.Code)
+	}
+}
+
+func TestNewRouter_DebugRoutesDisabled(t *testing.T) {
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with debug routes disabled, got %d", rec.Code)
+	}
+}
+
+func TestNewAuthenticator_FollowsKeyRotation(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:old")
+	live := newLiveConfig(testConfig(t))
+	authn, err := newAuthenticator(context.Background(), live, testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+
+	t.Setenv("API_KEYS", "dash:new")
+	live.Store(testConfig(t))
+
+	for secret, wantOK := range map[string]bool{"old": false, "new": true} {
+		req := httptest.NewRequest(http.MethodGet, "/info", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		if _, err := authn.Authenticate(req); (err == nil) != wantOK {
+			t.Errorf("secret %q: expected accepted=%v, got error %v", secret, wantOK, err)
+		}
+	}
+}
+
+func TestNewAuthenticator_AcceptsKeysAddedAlongsideJWKS(t *testing.T) {
+	t.Setenv("JWT_JWKS", writeFile(t, "jwks.json",
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`))
+	t.Setenv("JWT_ISSUER", "https://issuer.example.com")
+	t.Setenv("JWT_AUDIENCE", "gitops-demo")
+	live := newLiveConfig(testConfig(t))
+	authn, err := newAuthenticator(context.Background(), live, testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+
+	t.Setenv("API_KEYS", "dash:added")
+	reloadConfig(testLogger(), live, loadConfig)
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	req.Header.Set("Authorization", "Bearer added")
+	if p, err := authn.Authenticate(req); err != nil || p.ID != "dash" {
+		t.Errorf("expected the added key to be accepted, got %+v, %v", p, err)
+	}
+}
+
+func TestNewAuthenticator_NoneConfigured(t *testing.T) {
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(testConfig(t)), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if authn != nil {
+		t.Errorf("expected nil authenticator, got %T", authn)
+	}
+}
+
+func TestNewAuthenticator_JWKSLoadFailure(t *testing.T) {
+	t.Setenv("JWT_JWKS", filepath.Join(t.TempDir(), "missing.json"))
+	t.Setenv("JWT_ISSUER", "https://issuer.example.com")
+	t.Setenv("JWT_AUDIENCE", "gitops-demo")
+
+	if _, err := newAuthenticator(context.Background(), newLiveConfig(testConfig(t)), testLogger(), lifecycle.New(testLogger())); err == nil {
+		t.Error("expected an error for a missing JWKS")
+	}
+}
+
+func TestNewAuthenticator_JWKSRefreshIsAComponent(t *testing.T) {
+	t.Setenv("JWT_JWKS", writeFile(t, "jwks.json",
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`))
+	t.Setenv("JWT_ISSUER", "https://issuer.example.com")
+	t.Setenv("JWT_AUDIENCE", "gitops-demo")
+
+	app := lifecycle.New(testLogger())
+	if _, err := newAuthenticator(context.Background(), newLiveConfig(testConfig(t)), testLogger(), app); err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+
+	report := app.Stop(context.Background())
+	if len(report) != 1 || report[0].Component != "jwks-refresh" || report[0].Err != nil {
+		t.Errorf("expected jwks-refresh to stop cleanly, got %+v", report)
+	}
+}
+
+func TestNewRouter_CompressesLargeResponses(t *testing.T) {
+	t.Setenv("COMPRESSION_MIN_SIZE", "0")
+	r := newRouter(testLogger(), newLiveConfig(testConfig(t)), nil, nil, nil, prometheus.NewRegistry(), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("expected Content-Encoding gzip, got %q", got)
+	}
+}
+
+func TestRun_ProxyProtocol(t *testing.T) {
+	t.Setenv("PROXY_PROTOCOL_ENABLED", "true")
+	t.Setenv("PROXY_PROTOCOL_TRUSTED", "127.0.0.0/8")
+	t.Setenv("LISTEN", "127.0.0.1:0")
+	cfg := testConfig(t)
+
+	logger := testLogger()
+	addrCh := make(chan string, 1)
+	srv := newServer("0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrCh <- r.RemoteAddr
+	}))
+
+	opened, err := listener.Listen(cfg.Listen, listener.Options{})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	lns := serveListeners(cfg, opened)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- runServer(ctx, srv, logger, lns...) }()
+
+	conn, err := net.Dial("tcp", lns[0].Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_, _ = io.WriteString(conn, "PROXY TCP4 203.0.113.7 192.0.2.10 51000 443\r\nGET / HTTP/1.1\r\nHost: test\r\n\r\n")
+
+	select {
+	case got := <-addrCh:
+		if got != "203.0.113.7:51000" {
+			t.Errorf("expected RemoteAddr from the PROXY header, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not served")
+	}
+	_ = conn.Close()
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Errorf("expected nil error on graceful shutdown, got: %v", err)
+	}
+}
+
+func TestRun_MultipleListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "gitops-demo.sock")
+	t.Setenv("LISTEN", "tcp4:127.0.0.1:0,unix:"+sock)
+	cfg := testConfig(t)
+
+	logger := testLogger()
+	srv := newServer(cfg.Port, newRouter(logger, newLiveConfig(cfg), nil, nil, nil, prometheus.NewRegistry(), nil))
+	opened, err := listener.Listen(cfg.Listen, listener.Options{})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	lns := serveListeners(cfg, opened)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- runServer(ctx, srv, logger, lns...) }()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	clients := map[string]*http.Client{
+		"http://" + lns[0].Addr().String(): http.DefaultClient,
+		"http://unix":                      unixClient,
+	}
+	for base, client := range clients {
+		resp, err := client.Get(base + "/healthz")
+		if err != nil {
+			t.Fatalf("GET %s: %v", base, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", base, http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Errorf("expected nil error on graceful shutdown, got: %v", err)
+	}
+}
+
+func TestWatchRestart_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchRestart(ctx, func() { t.Error("unexpected drain") }, testLogger(), nil, time.Second)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchRestart did not return after cancellation")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/mstephenholl/gitops-demo/internal/handlers"
+	"github.com/mstephenholl/gitops-demo/internal/lifecycle"
+)
+
+// maintenanceFile reports whether the maintenance file at path exists and
+// returns its trimmed contents, which replace the configured message.
+func maintenanceFile(path string) (message string, exists bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// addMaintenanceWatcher registers the components that switch maintenance
+// mode on m: "maintenance-file" checks the file at path once, so that a file
+// present at startup turns the API routes away before the server is up, and
+// "maintenance-watcher", which depends on it, follows the file and SIGUSR1.
+func addMaintenanceWatcher(app *lifecycle.Manager, logger *slog.Logger, m *handlers.Maintenance, path string) {
+	file := &maintenanceSwitch{logger: logger, m: m, path: path}
+	app.Add("maintenance-file", lifecycle.Hooks{OnStart: func(context.Context) error {
+		file.check()
+		return nil
+	}}, lifecycle.Options{})
+	app.Add("maintenance-watcher", lifecycle.Background(func(ctx context.Context) error {
+		watchMaintenance(ctx, logger, m, file)
+		return nil
+	}), lifecycle.Options{DependsOn: []string{"maintenance-file"}, StopTimeout: time.Second})
+}
+
+// maintenanceSwitch turns maintenance mode on while the file at path exists
+// and off when it goes. Only changes since the last check switch it, so that
+// SIGUSR1 and the admin routes are not overruled by an unchanged file.
+type maintenanceSwitch struct {
+	logger *slog.Logger
+	m      *handlers.Maintenance
+	path   string
+
+	message string
+	exists  bool
+}
+
+// check reads the file and switches maintenance mode if it changed. It does
+// nothing when no path is set.
+func (s *maintenanceSwitch) check() {
+	if s.path == "" {
+		return
+	}
+	message, exists, err := maintenanceFile(s.path)
+	if err != nil {
+		s.logger.Warn("cannot read maintenance file", slog.String("path", s.path), slog.String("error", err.Error()))
+		return
+	}
+	if exists == s.exists && message == s.message {
+		return
+	}
+	s.message, s.exists = message, exists
+	if exists {
+		s.m.Enable(message, "file")
+	} else {
+		s.m.Disable("file")
+	}
+}
+
+// watchMaintenance toggles maintenance mode on m on SIGUSR1 and, when file
+// has a path, follows that file until ctx is done. The file is checked again
+// once it is watched, to catch a change since the last check.
+func watchMaintenance(ctx context.Context, logger *slog.Logger, m *handlers.Maintenance, file *maintenanceSwitch) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	path := file.path
+	if path != "" {
+		w, err := watchDirs([]string{path})
+		if err != nil {
+			logger.Error("cannot watch maintenance file, use SIGUSR1 instead",
+				slog.String("path", path), slog.String("error", err.Error()))
+		} else {
+			defer func() { _ = w.Close() }()
+			events, errs = w.Events, w.Errors
+		}
+		file.check()
+	}
+
+	const settle = 100 * time.Millisecond
+	debounce := time.NewTimer(settle)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr1:
+			m.Toggle("SIGUSR1")
+		case ev := <-events:
+			if watchedEvent([]string{path}, ev.Name) {
+				debounce.Reset(settle)
+			}
+		case err := <-errs:
+			logger.Warn("maintenance file watch error", slog.String("error", err.Error()))
+		case <-debounce.C:
+			file.check()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mstephenholl/gitops-demo/internal/handlers"
+	"github.com/mstephenholl/gitops-demo/internal/lifecycle"
+)
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchMaintenance_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	if err := os.WriteFile(path, []byte("migrating\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := handlers.NewMaintenance(testLogger(), handlers.MaintenanceConfig{Message: "down"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	go watchMaintenance(ctx, logger, m, &maintenanceSwitch{logger: logger, m: m, path: path})
+
+	waitFor(t, "maintenance from the file present at startup", func() bool {
+		st := m.Status()
+		return st.Enabled && st.Message == "migrating" && st.By == "file"
+	})
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "maintenance to end with the file", func() bool { return !m.Status().Enabled })
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "an empty file to use the configured message", func() bool {
+		st := m.Status()
+		return st.Enabled && st.Message == "down"
+	})
+}
+
+func TestAddMaintenanceWatcher_ChecksFileBeforeStartReturns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	if err := os.WriteFile(path, []byte("migrating\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := handlers.NewMaintenance(testLogger(), handlers.MaintenanceConfig{Message: "down"})
+	app := lifecycle.New(testLogger())
+	addMaintenanceWatcher(app, testLogger(), m, path)
+
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer app.Stop(context.Background())
+
+	if st := m.Status(); !st.Enabled || st.Message != "migrating" {
+		t.Errorf("expected maintenance on once started, got %+v", st)
+	}
+}
+
+func TestNewRouter_Maintenance(t *testing.T) {
+	t.Setenv("API_KEYS", "dash:s3cret,ops:0ps:admin")
+	cfg := testConfig(t)
+	authn, err := newAuthenticator(context.Background(), newLiveConfig(cfg), testLogger(), lifecycle.New(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to build authenticator: %v", err)
+	}
+	maint := handlers.NewMaintenance(testLogger(), cfg.Maintenance)
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, maint, nil, prometheus.NewRegistry(), authn)
+
+	do := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/maintenance", "s3cret"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the switch to need the admin scope, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/maintenance", "0ps"); rec.Code != http.StatusOK {
+		t.Fatalf("expected maintenance to be switched on, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, "/flags", "s3cret")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "300" {
+		t.Errorf("expected 503 with Retry-After from /flags, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "service is down for maintenance") {
+		t.Errorf("expected the maintenance message, got %s", rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/info", "s3cret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"maintenance":{"enabled":true`) {
+		t.Errorf("expected /info to report maintenance on, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if rec := do(http.MethodGet, path, "s3cret"); rec.Code != http.StatusOK {
+			t.Errorf("expected %s to be served during maintenance, got %d", path, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodDelete, "/maintenance", "0ps"); rec.Code != http.StatusOK {
+		t.Fatalf("expected maintenance to be switched off, got %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/info", "s3cret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"maintenance":{"enabled":false`) {
+		t.Errorf("expected /info to report maintenance off, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestNewRouter_InfoIsConcurrencyLimited(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ConcurrencyLimitEnabled = true
+	cfg.ConcurrencyLimit.InitialLimit = 0
+	maint := handlers.NewMaintenance(testLogger(), cfg.Maintenance)
+	maint.Enable("", "ops")
+	r := newRouter(testLogger(), newLiveConfig(cfg), nil, maint, nil, prometheus.NewRegistry(), nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "server is at capacity") {
+		t.Errorf("expected /info to be turned away at capacity, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected %s to bypass the limiter, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadableKeys are the settings a reload applies without a restart.
+// applyReloadable must copy the matching fields.
+var reloadableKeys = []string{
+	"LOG_LEVEL",
+	"PROBE_TIMEOUT",
+	"REQUEST_TIMEOUT",
+	"CONCURRENCY_LIMIT_INITIAL",
+	"CONCURRENCY_LIMIT_MIN",
+	"CONCURRENCY_LIMIT_MAX",
+	"CONCURRENCY_LATENCY_TARGET",
+	"CONCURRENCY_BACKOFF",
+	"API_KEYS",
+	"API_KEYS_FILE",
+	"FLAGS",
+	"FLAGS_FILE",
+	"MAINTENANCE_MESSAGE",
+	"MAINTENANCE_RETRY_AFTER",
+	"MAINTENANCE_ALLOWLIST",
+}
+
+// reloadable reports whether a change to key can be applied to running.
+// API keys cannot be added to a server that started without
+// authentication, since its routes were built unauthenticated.
+func reloadable(running config, key string) bool {
+	if key == "API_KEYS" || key == "API_KEYS_FILE" {
+		return running.authEnabled
+	}
+	return slices.Contains(reloadableKeys, key)
+}
+
+// applyReloadable returns running with the reloadable settings taken from
+// next. Everything else keeps the value the server started with.
+func applyReloadable(running, next config) config {
+	running.LogLevel = next.LogLevel
+	running.ProbeTimeout = next.ProbeTimeout
+	running.RequestTimeout = next.RequestTimeout
+	running.ConcurrencyLimit = next.ConcurrencyLimit
+	if running.authEnabled {
+		running.APIKeys = next.APIKeys
+	}
+	running.Flags = next.Flags
+	running.Maintenance = next.Maintenance
+
+	running.settings = slices.Clone(running.settings)
+	for i, s := range running.settings {
+		if reloadable(running, s.Key) {
+			if ns := next.setting(s.Key); ns != nil {
+				running.settings[i] = *ns
+			}
+		}
+	}
+	return running
+}
+
+// liveConfig holds the configuration in effect. Reloads swap it atomically
+// and then notify the components that apply reloadable settings.
+type liveConfig struct {
+	current atomic.Pointer[config]
+
+	mu         sync.Mutex
+	onChange   []func(config)
+	lastReload time.Time
+}
+
+func newLiveConfig(cfg config) *liveConfig {
+	l := &liveConfig{}
+	l.current.Store(&cfg)
+	return l
+}
+
+// Load returns the configuration in effect.
+func (l *liveConfig) Load() config {
+	return *l.current.Load()
+}
+
+// OnChange registers fn to be called with the new configuration after
+// every reload.
+func (l *liveConfig) OnChange(fn func(config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = append(l.onChange, fn)
+}
+
+// Store makes cfg the configuration in effect.
+func (l *liveConfig) Store(cfg config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current.Store(&cfg)
+	l.lastReload = time.Now()
+	for _, fn := range l.onChange {
+		fn(cfg)
+	}
+}
+
+// LastReload returns when Store last replaced the configuration, or the
+// zero time if it never has.
+func (l *liveConfig) LastReload() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastReload
+}
+
+// settingChange is one key whose effective value differs between two
+// configurations.
+type settingChange struct {
+	Key      string
+	Old, New setting
+}
+
+// diffSettings lists the keys whose value or source differs, including
+// secrets and secret files whose contents changed.
+func diffSettings(old, next config) []settingChange {
+	var changes []settingChange
+	for _, ns := range next.settings {
+		var prev setting
+		if ps := old.setting(ns.Key); ps != nil {
+			prev = *ps
+		}
+		if prev.Value != ns.Value || prev.Source != ns.Source || prev.digest != ns.digest {
+			changes = append(changes, settingChange{Key: ns.Key, Old: prev, New: ns})
+		}
+	}
+	return changes
+}
+
+// LogValue describes the change for the reload log, hiding secret values.
+func (c settingChange) LogValue() slog.Value {
+	if c.New.Secret || c.Old.Secret {
+		return slog.GroupValue(slog.String("source", c.New.Source), slog.String("value", redacted))
+	}
+	attrs := []slog.Attr{
+		slog.String("old", c.Old.Value),
+		slog.String("new", c.New.Value),
+		slog.String("source", c.New.Source),
+	}
+	if c.Old.Value == c.New.Value && c.Old.digest != c.New.digest {
+		attrs = append(attrs, slog.Bool("rotated", true))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// reloadConfig loads a new configuration and applies its reloadable
+// settings to live. An invalid configuration is logged and rejected, leaving
+// live unchanged. Changes to settings that need a restart are logged but
+// not applied.
+func reloadConfig(logger *slog.Logger, live *liveConfig, load func() (config, error)) {
+	next, err := load()
+	if err != nil {
+		logger.Error("config reload rejected", slog.String("error", err.Error()))
+		return
+	}
+
+	running := live.Load()
+	var changes, pending []slog.Attr
+	for _, c := range diffSettings(running, next) {
+		attr := slog.Any(c.Key, c)
+		if reloadable(running, c.Key) {
+			changes = append(changes, attr)
+		} else {
+			pending = append(pending, attr)
+		}
+	}
+
+	if len(pending) > 0 {
+		logger.Warn("config changes need a restart to take effect", slog.Any("changes", slog.GroupValue(pending...)))
+	}
+	if len(changes) == 0 {
+		logger.Info("config reloaded, no changes applied")
+		return
+	}
+	applied := applyReloadable(running, next)
+	live.Store(applied)
+	logger.Info("config reloaded",
+		slog.Any("changes", slog.GroupValue(changes...)),
+		slog.String("config_hash", applied.fingerprint()),
+	)
+}
+
+// watchConfig reloads the configuration on SIGHUP and, whenever the config
+// file or a secret file changes, until ctx is done. The files' directories
+// are watched rather than the files themselves so that the atomic symlink
+// swap used for mounted ConfigMaps and Secrets is seen.
+func watchConfig(ctx context.Context, logger *slog.Logger, live *liveConfig, load func() (config, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	files := live.Load().watchedFiles()
+	if len(files) > 0 {
+		w, err := watchDirs(files)
+		if err != nil {
+			logger.Error("cannot watch config files, reload with SIGHUP instead",
+				slog.Any("paths", files), slog.String("error", err.Error()))
+		} else {
+			defer func() { _ = w.Close() }()
+			events, errs = w.Events, w.Errors
+		}
+	}
+
+	// Editors and ConfigMap updates touch the file several times; wait for
+	// the writes to settle before reloading once.
+	const settle = 100 * time.Millisecond
+	debounce := time.NewTimer(settle)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("reloading config", slog.String("trigger", "SIGHUP"))
+			reloadConfig(logger, live, load)
+		case ev := <-events:
+			if watchedEvent(files, ev.Name) {
+				debounce.Reset(settle)
+			}
+		case err := <-errs:
+			logger.Warn("config file watch error", slog.String("error", err.Error()))
+		case <-debounce.C:
+			logger.Info("reloading config", slog.String("trigger", "file change"))
+			reloadConfig(logger, live, load)
+		}
+	}
+}
+
+// watchedFiles are the files whose changes trigger a reload.
+func (c config) watchedFiles() []string {
+	var files []string
+	if c.ConfigFile != "" {
+		files = append(files, c.ConfigFile)
+	}
+	return append(files, c.files...)
+}
+
+// watchDirs returns a watcher on the directories holding files.
+func watchDirs(files []string) (*fsnotify.Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := w.Add(filepath.Dir(f)); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// watchedEvent reports whether an event on name concerns one of files.
+// Kubernetes updates mounted ConfigMaps and Secrets by swapping the ..data
+// symlink in their directory rather than writing the files.
+func watchedEvent(files []string, name string) bool {
+	for _, f := range files {
+		if filepath.Clean(name) == filepath.Clean(f) {
+			return true
+		}
+		if filepath.Base(name) == "..data" && filepath.Dir(name) == filepath.Dir(filepath.Clean(f)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent logging and reading.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReloadConfig_AppliesReloadableSettings(t *testing.T) {
+	path := writeFile(t, "config.yaml", "request_timeout: 5s\nport: 8080\n")
+	t.Setenv("CONFIG_FILE", path)
+	live := newLiveConfig(testConfig(t))
+
+	var notified config
+	live.OnChange(func(c config) { notified = c })
+
+	if err := os.WriteFile(path, []byte("request_timeout: 7s\nport: 9090\nlog_level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	cfg := live.Load()
+	if cfg.RequestTimeout != 7*time.Second {
+		t.Errorf("expected RequestTimeout 7s after reload, got %v", cfg.RequestTimeout)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("expected LogLevel debug after reload, got %v", cfg.LogLevel)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("expected Port to need a restart, got %q", cfg.Port)
+	}
+	if got := cfg.setting("REQUEST_TIMEOUT").Value; got != "7s" {
+		t.Errorf("expected the effective setting to be updated, got %q", got)
+	}
+	if notified.RequestTimeout != 7*time.Second {
+		t.Error("expected OnChange to receive the new configuration")
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"config reloaded",
+		"changes.REQUEST_TIMEOUT.old=5s changes.REQUEST_TIMEOUT.new=7s",
+		"config changes need a restart",
+		"changes.PORT.old=8080 changes.PORT.new=9090",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestReloadConfig_RejectsInvalidConfig(t *testing.T) {
+	path := writeFile(t, "config.yaml", "request_timeout: 5s\n")
+	t.Setenv("CONFIG_FILE", path)
+	live := newLiveConfig(testConfig(t))
+	live.OnChange(func(config) { t.Error("unexpected reload") })
+
+	if err := os.WriteFile(path, []byte("request_timeout: 7s\nconcurrency_backoff: 2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	if got := live.Load().RequestTimeout; got != 5*time.Second {
+		t.Errorf("expected the running config to be kept, got RequestTimeout %v", got)
+	}
+	if !strings.Contains(buf.String(), "config reload rejected") {
+		t.Errorf("expected a rejection to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestReloadConfig_RedactsSecrets(t *testing.T) {
+	t.Setenv("API_KEYS", "ci:old-secret")
+	live := newLiveConfig(testConfig(t))
+	t.Setenv("API_KEYS", "ci:new-secret")
+
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("expected secrets to be redacted, got:\n%s", out)
+	}
+	if !strings.Contains(out, "changes.API_KEYS.value=[redacted]") {
+		t.Errorf("expected the redacted change to be logged, got:\n%s", out)
+	}
+}
+
+func TestReloadConfig_APIKeysNeedRestartWithoutAuth(t *testing.T) {
+	live := newLiveConfig(testConfig(t))
+	t.Setenv("API_KEYS", "ci:new-secret")
+
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	if keys := live.Load().APIKeys; len(keys) != 0 {
+		t.Errorf("expected the keys not to be applied, got %d", len(keys))
+	}
+	out := buf.String()
+	if !strings.Contains(out, "config changes need a restart") || !strings.Contains(out, "changes.API_KEYS.value=[redacted]") {
+		t.Errorf("expected the keys to be reported as needing a restart, got:\n%s", out)
+	}
+	if strings.Contains(out, "msg=\"config reloaded\"") {
+		t.Errorf("expected nothing to be applied, got:\n%s", out)
+	}
+}
+
+func TestReloadConfig_AppliesFlagsFileEdits(t *testing.T) {
+	path := writeFile(t, "flags", "new-checkout=10%\n")
+	t.Setenv("FLAGS_FILE", path)
+	live := newLiveConfig(testConfig(t))
+
+	if err := os.WriteFile(path, []byte("new-checkout=50%\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	if fs := live.Load().Flags; len(fs) != 1 || fs[0].Value() != "50%" {
+		t.Errorf("expected the edited flag after reload, got %+v", fs)
+	}
+	if !strings.Contains(buf.String(), "changes.FLAGS_FILE") {
+		t.Errorf("expected the flags file change to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestWatchConfig_ReloadsOnFileChange(t *testing.T) {
+	path := writeFile(t, "config.yaml", "request_timeout: 5s\n")
+	t.Setenv("CONFIG_FILE", path)
+	live := newLiveConfig(testConfig(t))
+
+	reloaded := make(chan config, 1)
+	live.OnChange(func(c config) { reloaded <- c })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf syncBuffer
+	go watchConfig(ctx, slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	// Rewrite until the watcher, which starts asynchronously, sees a change.
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := os.WriteFile(path, []byte("request_timeout: 7s\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case c := <-reloaded:
+			if c.RequestTimeout != 7*time.Second {
+				t.Errorf("expected RequestTimeout 7s, got %v", c.RequestTimeout)
+			}
+			return
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("config was not reloaded, log:\n%s", buf.String())
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// redacted replaces secret values wherever settings are logged or exposed.
+const redacted = "[redacted]"
+
+// secretFilePerm are the permission bits a secret file must not have: it
+// must not be readable by others or writable by anyone but its owner.
+// Kubernetes Secret volumes need a defaultMode such as 0440 to pass.
+const secretFilePerm fs.FileMode = 0o026
+
+// readSecretFile reads a secret from a file such as a mounted Kubernetes
+// Secret, trimming surrounding whitespace and the trailing newline editors
+// add. Files that are not regular files or whose permissions are too open
+// are refused.
+func readSecretFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", errors.New("not a regular file")
+	}
+	if perm := fi.Mode().Perm(); perm&secretFilePerm != 0 {
+		return "", fmt.Errorf("permissions %#o are too open, remove %#o", perm, perm&secretFilePerm)
+	}
+
+	b, err := os.ReadFile(path) // #nosec G304 -- path comes from operator config
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSecretFile_TrimsWhitespace(t *testing.T) {
+	path := writeFile(t, "token", "  s3cret\n\n")
+
+	got, err := readSecretFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "s3cret" {
+		t.Errorf("expected %q, got %q", "s3cret", got)
+	}
+}
+
+func TestReadSecretFile_Rejects(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		wantErr string
+	}{
+		{"world readable", 0o644, "permissions 0644 are too open, remove 04"},
+		{"group writable", 0o660, "permissions 0660 are too open, remove 020"},
+		{"world writable", 0o602, "too open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, "token", "s3cret")
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readSecretFile(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := readSecretFile(dir); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("expected a directory to be refused, got %v", err)
+	}
+}
+
+func TestReadSecretFile_AllowsOwnerAndGroupRead(t *testing.T) {
+	path := writeFile(t, "token", "s3cret")
+	if err := os.Chmod(path, 0o440); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSecretFile(path); err != nil {
+		t.Errorf("expected 0440 to be accepted, got %v", err)
+	}
+}
+
+func TestLoadConfig_SecretsAreRedacted(t *testing.T) {
+	path := writeFile(t, "api-keys", "ops:f1le-secret\n")
+	t.Setenv("API_KEYS", "dash:env-secret")
+	t.Setenv("API_KEYS_FILE", path)
+
+	cfg := testConfig(t)
+
+	if len(cfg.APIKeys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(cfg.APIKeys))
+	}
+	if got := cfg.setting("API_KEYS").Value; got != redacted {
+		t.Errorf("expected API_KEYS to be recorded redacted, got %q", got)
+	}
+	if got := cfg.setting("API_KEYS_FILE").Value; got != path {
+		t.Errorf("expected API_KEYS_FILE to record the path, got %q", got)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("config", slog.Any("config", cfg))
+	if out := buf.String(); strings.Contains(out, "secret") {
+		t.Errorf("expected secrets to stay out of the log, got:\n%s", out)
+	}
+}
+
+func TestReloadConfig_RotatesSecretFile(t *testing.T) {
+	path := writeFile(t, "api-keys", "ops:old-secret\n")
+	t.Setenv("API_KEYS_FILE", path)
+	live := newLiveConfig(testConfig(t))
+
+	if err := os.WriteFile(path, []byte("ops:new-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	reloadConfig(slog.New(slog.NewTextHandler(&buf, nil)), live, loadConfig)
+
+	if keys := live.Load().APIKeys; len(keys) != 1 || keys[0].Secret != "new-secret" {
+		t.Errorf("expected the rotated key to be applied, got %d keys", len(keys))
+	}
+	out := buf.String()
+	if !strings.Contains(out, "changes.API_KEYS_FILE.rotated=true") {
+		t.Errorf("expected the rotation to be logged, got:\n%s", out)
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("expected secrets to stay out of the log, got:\n%s", out)
+	}
+}
+
+func TestWatchedEvent(t *testing.T) {
+	files := []string{"/etc/gitops-demo/config.yaml", "/var/run/secrets/api/keys"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"/etc/gitops-demo/config.yaml", true},
+		{"/etc/gitops-demo/other.yaml", false},
+		{"/var/run/secrets/api/keys", true},
+		{"/var/run/secrets/api/..data", true},
+		{"/var/run/secrets/other/..data", false},
+	}
+	for _, tt := range tests {
+		if got := watchedEvent(files, filepath.FromSlash(tt.name)); got != tt.want {
+			t.Errorf("watchedEvent(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package auth authenticates API callers and carries the resulting
+// principal through the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+var (
+	// ErrNoCredentials is returned when a request carries no credentials
+	// that an Authenticator recognises.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when a request carries credentials
+	// that fail verification.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Scopes []string `json:"scopes,omitempty"`
+	// Claims holds the verified token claims for JWT principals.
+	Claims map[string]any `json:"-"`
+}
+
+// HasScopes reports whether p holds every one of scopes.
+func (p Principal) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(p.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authenticator verifies the credentials carried by a request.
+type Authenticator interface {
+	// Authenticate returns the caller's principal, ErrNoCredentials when
+	// the request carries none it understands, or an error wrapping
+	// ErrInvalidCredentials when verification fails.
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Chain tries each Authenticator in order and returns the first result that
+// is not ErrNoCredentials.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return p, err
+		}
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubAuthenticator struct {
+	p   Principal
+	err error
+}
+
+func (s stubAuthenticator) Authenticate(*http.Request) (Principal, error) { return s.p, s.err }
+
+func TestPrincipal_HasScopes(t *testing.T) {
+	p := Principal{ID: "ops", Scopes: []string{"read", "admin"}}
+
+	if !p.HasScopes() {
+		t.Error("expected no required scopes to be satisfied")
+	}
+	if !p.HasScopes("read", "admin") {
+		t.Error("expected read and admin to be satisfied")
+	}
+	if p.HasScopes("read", "write") {
+		t.Error("expected write to be missing")
+	}
+}
+
+func TestContext_RoundTrip(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("expected no principal in empty context")
+	}
+
+	ctx := NewContext(context.Background(), Principal{ID: "dash"})
+	p, ok := FromContext(ctx)
+	if !ok || p.ID != "dash" {
+		t.Errorf("expected principal %q, got %+v (ok=%v)", "dash", p, ok)
+	}
+}
+
+func TestChain_Authenticate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	chain := Chain{
+		stubAuthenticator{err: ErrNoCredentials},
+		stubAuthenticator{p: Principal{ID: "second"}},
+		stubAuthenticator{p: Principal{ID: "third"}},
+	}
+	p, err := chain.Authenticate(req)
+	if err != nil || p.ID != "second" {
+		t.Errorf("expected second authenticator to win, got %+v, %v", p, err)
+	}
+
+	chain = Chain{
+		stubAuthenticator{err: ErrInvalidCredentials},
+		stubAuthenticator{p: Principal{ID: "second"}},
+	}
+	if _, err := chain.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials to stop the chain, got %v", err)
+	}
+
+	if _, err := (Chain{}).Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials from empty chain, got %v", err)
+	}
+}
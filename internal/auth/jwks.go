@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJWKSBytes bounds the size of a fetched JWKS document.
+const maxJWKSBytes = 1 << 20
+
+// KeySet holds the public keys of a JSON Web Key Set loaded from a file or
+// an http(s) URL. Keys are looked up by their "kid".
+type KeySet struct {
+	source string
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+}
+
+// NewKeySet returns an empty KeySet for source, which is either a file path
+// or an http(s) URL. Call Refresh to load it. A nil client uses a client
+// with a 10s timeout.
+func NewKeySet(source string, client *http.Client) *KeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &KeySet{source: source, client: client}
+}
+
+// Key returns the public key with the given kid. A token without a kid
+// matches only when the set holds exactly one key.
+func (ks *KeySet) Key(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// Refresh reloads the key set from its source. On failure the previously
+// loaded keys are kept.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	b, err := ks.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(b)
+	if err != nil {
+		return fmt.Errorf("parse JWKS from %s: %w", ks.source, err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	return nil
+}
+
+// Run refreshes the key set every interval until ctx is done, logging
+// failures and keeping the last good keys.
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Refresh(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn("JWKS refresh failed",
+					slog.String("source", ks.source),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+func (ks *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+		b, err := os.ReadFile(strings.TrimPrefix(ks.source, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("read JWKS: %w", err)
+		}
+		return b, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build JWKS request: %w", err)
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS from %s: unexpected status %d", ks.source, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS response: %w", err)
+	}
+	return b, nil
+}
+
+// jwk is the subset of RFC 7517 fields needed for signature verification.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JWKS document into public keys indexed by kid. RSA,
+// EC (P-256, P-384, P-521) and OKP (Ed25519) signing keys are supported;
+// other keys are skipped. It is an error for no usable key to remain.
+func ParseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	var errs []error
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", k.Kid, err))
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	if len(keys) == 0 {
+		errs = append(errs, errors.New("no usable signing keys"))
+		return nil, errors.Join(errs...)
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeB64(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := decodeB64(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("exponent: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent out of range")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errUnsupportedKey
+		}
+		x, err := decodeB64(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeB64(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("coordinate too large for curve")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4 // uncompressed
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupportedKey
+		}
+		x, err := decodeB64(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errUnsupportedKey
+}
+
+func decodeB64(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
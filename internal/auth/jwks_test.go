@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// testKeys holds one signing key of each supported type.
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate EC key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// jwks renders the public halves of k as a JWKS document.
+func (k testKeys) jwks(t *testing.T) []byte {
+	t.Helper()
+	ecBytes, err := k.ec.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("encode EC key: %v", err)
+	}
+	size := (len(ecBytes) - 1) / 2
+
+	doc := map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa-1", "use": "sig",
+			"n": b64(k.rsa.N.Bytes()),
+			"e": b64(big.NewInt(int64(k.rsa.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64(ecBytes[1 : 1+size]),
+			"y": b64(ecBytes[1+size:]),
+		},
+		{
+			"kty": "OKP", "kid": "ed-1", "crv": "Ed25519",
+			"x": b64(k.ed.Public().(ed25519.PublicKey)),
+		},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "oct", "kid": "hmac-1", "k": "c2VjcmV0"},
+	}}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal JWKS: %v", err)
+	}
+	return b
+}
+
+func TestParseJWKS(t *testing.T) {
+	k := newTestKeys(t)
+
+	keys, err := ParseJWKS(k.jwks(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 signing keys, got %d", len(keys))
+	}
+	if pub, ok := keys["rsa-1"].(*rsa.PublicKey); !ok || !pub.Equal(&k.rsa.PublicKey) {
+		t.Error("expected rsa-1 to match the RSA public key")
+	}
+	if pub, ok := keys["ec-1"].(*ecdsa.PublicKey); !ok || !pub.Equal(&k.ec.PublicKey) {
+		t.Error("expected ec-1 to match the EC public key")
+	}
+	if pub, ok := keys["ed-1"].(ed25519.PublicKey); !ok || !pub.Equal(k.ed.Public()) {
+		t.Error("expected ed-1 to match the Ed25519 public key")
+	}
+}
+
+func TestParseJWKS_Errors(t *testing.T) {
+	tests := map[string]string{
+		"malformed":    `{"keys":`,
+		"empty":        `{"keys":[]}`,
+		"only hmac":    `{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`,
+		"bad ec point": `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		"bad ed size":  `{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AQ"}]}`,
+	}
+
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseJWKS([]byte(doc)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestKeySet_RefreshFromFile(t *testing.T) {
+	k := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, k.jwks(t), 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+
+	ks := NewKeySet(path, nil)
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := ks.Key("ec-1"); !ok {
+		t.Error("expected ec-1 to be loaded")
+	}
+	if _, ok := ks.Key("missing"); ok {
+		t.Error("expected unknown kid to be absent")
+	}
+	if _, ok := ks.Key(""); ok {
+		t.Error("expected empty kid to be ambiguous with several keys")
+	}
+}
+
+func TestKeySet_RefreshFromURL(t *testing.T) {
+	first, second := newTestKeys(t), newTestKeys(t)
+
+	var current atomic.Pointer[[]byte]
+	doc := first.jwks(t)
+	current.Store(&doc)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(*current.Load())
+	}))
+	defer srv.Close()
+
+	ks := NewKeySet(srv.URL, srv.Client())
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertKey(t, ks, "rsa-1", &first.rsa.PublicKey)
+
+	doc = second.jwks(t)
+	current.Store(&doc)
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertKey(t, ks, "rsa-1", &second.rsa.PublicKey)
+}
+
+func TestKeySet_RefreshFailureKeepsKeys(t *testing.T) {
+	k := newTestKeys(t)
+	fail := atomic.Bool{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(k.jwks(t))
+	}))
+	defer srv.Close()
+
+	ks := NewKeySet(srv.URL, srv.Client())
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fail.Store(true)
+	if err := ks.Refresh(context.Background()); err == nil {
+		t.Error("expected refresh to fail")
+	}
+	assertKey(t, ks, "rsa-1", &k.rsa.PublicKey)
+}
+
+func assertKey(t *testing.T, ks *KeySet, kid string, want interface{ Equal(crypto.PublicKey) bool }) {
+	t.Helper()
+	got, ok := ks.Key(kid)
+	if !ok {
+		t.Fatalf("expected key %q", kid)
+	}
+	if !want.Equal(got) {
+		t.Errorf("key %q does not match", kid)
+	}
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestJWTAuthenticator(t *testing.T, k testKeys) *JWTAuthenticator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, k.jwks(t), 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+	ks := NewKeySet(path, nil)
+	if err := ks.Refresh(context.Background()); err != nil {
+		t.Fatalf("load JWKS: %v", err)
+	}
+	return NewJWTAuthenticator(ks, JWTConfig{Issuer: "https://issuer.example.com", Audience: "gitops-demo"})
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   "https://issuer.example.com",
+		"aud":   "gitops-demo",
+		"sub":   "release-dashboard",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "info:read admin",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTAuthenticator_Algorithms(t *testing.T) {
+	k := newTestKeys(t)
+	a := newTestJWTAuthenticator(t, k)
+
+	tokens := map[string]string{
+		"RS256": sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, validClaims()),
+		"ES256": sign(t, jwt.SigningMethodES256, "ec-1", k.ec, validClaims()),
+		"EdDSA": sign(t, jwt.SigningMethodEdDSA, "ed-1", k.ed, validClaims()),
+	}
+
+	for alg, token := range tokens {
+		t.Run(alg, func(t *testing.T) {
+			p, err := a.Authenticate(bearerRequest(token))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.ID != "release-dashboard" || p.Method != "jwt" {
+				t.Errorf("unexpected principal: %+v", p)
+			}
+			if !slices.Equal(p.Scopes, []string{"info:read", "admin"}) {
+				t.Errorf("unexpected scopes: %v", p.Scopes)
+			}
+			if p.Claims["iss"] != "https://issuer.example.com" {
+				t.Errorf("expected claims to be exposed, got %v", p.Claims)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticator_Rejects(t *testing.T) {
+	k := newTestKeys(t)
+	other := newTestKeys(t)
+	a := newTestJWTAuthenticator(t, k)
+
+	with := func(key string, value any) jwt.MapClaims {
+		c := validClaims()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := map[string]string{
+		"wrong issuer":      sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("iss", "https://evil.example.com")),
+		"wrong audience":    sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("aud", "other")),
+		"expired":           sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":         sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("exp", nil)),
+		"not yet valid":     sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("nbf", time.Now().Add(time.Hour).Unix())),
+		"no subject":        sign(t, jwt.SigningMethodRS256, "rsa-1", k.rsa, with("sub", nil)),
+		"unknown kid":       sign(t, jwt.SigningMethodRS256, "rsa-9", k.rsa, validClaims()),
+		"wrong signature":   sign(t, jwt.SigningMethodRS256, "rsa-1", other.rsa, validClaims()),
+		"key type mismatch": sign(t, jwt.SigningMethodES256, "rsa-1", k.ec, validClaims()),
+		"disallowed alg":    sign(t, jwt.SigningMethodPS256, "rsa-1", k.rsa, validClaims()),
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.Authenticate(bearerRequest(token))
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticator_IgnoresNonJWT(t *testing.T) {
+	a := newTestJWTAuthenticator(t, newTestKeys(t))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		bearerRequest("static-api-key"),
+		bearerRequest("svc.deploy.k3d-0f9e"),
+		bearerRequest("e30.e30.sig"),
+	} {
+		if _, err := a.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("expected ErrNoCredentials, got %v", err)
+		}
+	}
+}
+
+func TestScopes_SCPArray(t *testing.T) {
+	got := scopes(jwt.MapClaims{"scp": []any{"a", "b", 3}})
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("expected [a b], got %v", got)
+	}
+}
+
+func TestChain_DottedAPIKeyReachesStaticKeys(t *testing.T) {
+	chain := Chain{
+		newTestJWTAuthenticator(t, newTestKeys(t)),
+		NewStaticKeys([]Key{{ID: "deployer", Secret: "svc.deploy.k3d-0f9e"}}),
+	}
+
+	p, err := chain.Authenticate(bearerRequest("svc.deploy.k3d-0f9e"))
+	if err != nil {
+		t.Fatalf("expected the API key to authenticate, got %v", err)
+	}
+	if p.ID != "deployer" || p.Method != "bearer" {
+		t.Errorf("expected deployer via bearer, got %+v", p)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Key is a static credential mapped to a principal.
+type Key struct {
+	ID     string
+	Secret string
+	Scopes []string
+}
+
+// LogValue keeps the secret out of logs.
+func (k Key) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", k.ID),
+		slog.Any("scopes", k.Scopes),
+	)
+}
+
+// ParseKeys parses credentials in the form "id:secret[:scope|scope...]",
+// separated by commas or newlines. Blank lines and lines starting with '#'
+// are ignored, so the same format works for env vars and mounted files.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for entry := range strings.SplitSeq(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			k, err := parseKey(entry)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read keys: %w", err)
+	}
+	return keys, nil
+}
+
+func parseKey(entry string) (Key, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		// Only the id is safe to echo back; the rest may be a secret.
+		id, _, _ := strings.Cut(entry, ":")
+		return Key{}, fmt.Errorf("key %q must have the form id:secret[:scopes]", id)
+	}
+
+	k := Key{ID: parts[0], Secret: parts[1]}
+	if len(parts) == 3 {
+		for s := range strings.SplitSeq(parts[2], "|") {
+			if s = strings.TrimSpace(s); s != "" {
+				k.Scopes = append(k.Scopes, s)
+			}
+		}
+	}
+	return k, nil
+}
+
+// StaticKeys authenticates requests presenting one of a fixed set of
+// secrets, either as "Authorization: Bearer <secret>" or "X-API-Key:
+// <secret>". Secrets are held only as SHA-256 digests, so lookups do not
+// leak timing information about the stored values.
+type StaticKeys struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewStaticKeys returns an authenticator for keys.
+func NewStaticKeys(keys []Key) *StaticKeys {
+	s := &StaticKeys{}
+	s.Replace(keys)
+	return s
+}
+
+// Replace atomically swaps the accepted keys.
+func (s *StaticKeys) Replace(keys []Key) {
+	m := make(map[[sha256.Size]byte]Principal, len(keys))
+	for _, k := range keys {
+		m[sha256.Sum256([]byte(k.Secret))] = Principal{ID: k.ID, Scopes: k.Scopes}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = m
+}
+
+// Len returns the number of accepted keys.
+func (s *StaticKeys) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys)
+}
+
+// Authenticate implements Authenticator.
+func (s *StaticKeys) Authenticate(r *http.Request) (Principal, error) {
+	secret, method := credentials(r)
+	if secret == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	s.mu.RLock()
+	p, ok := s.keys[sha256.Sum256([]byte(secret))]
+	s.mu.RUnlock()
+	if !ok {
+		return Principal{}, fmt.Errorf("%s: %w", method, ErrInvalidCredentials)
+	}
+
+	p.Method = method
+	return p, nil
+}
+
+// credentials extracts a static secret from the request and names the
+// scheme it arrived with.
+func credentials(r *http.Request) (secret, method string) {
+	if token, ok := BearerToken(r); ok {
+		return token, "bearer"
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, "api_key"
+	}
+	return "", ""
+}
+
+// BearerToken returns the token from an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("dash:s3cret, ops:t0ken:read|admin\n# comment\n\nci:abc:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(keys))
+	}
+	if keys[0].ID != "dash" || keys[0].Secret != "s3cret" || len(keys[0].Scopes) != 0 {
+		t.Errorf("unexpected first key: %+v", keys[0])
+	}
+	if keys[1].ID != "ops" || !slices.Equal(keys[1].Scopes, []string{"read", "admin"}) {
+		t.Errorf("unexpected second key: %+v", keys[1])
+	}
+	if keys[2].ID != "ci" || len(keys[2].Scopes) != 0 {
+		t.Errorf("unexpected third key: %+v", keys[2])
+	}
+}
+
+func TestParseKeys_Invalid(t *testing.T) {
+	for _, in := range []string{"justanid", ":secret", "id:"} {
+		_, err := ParseKeys(in)
+		if err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestParseKeys_ErrorOmitsSecret(t *testing.T) {
+	_, err := ParseKeys("ops:")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "ops:") {
+		t.Errorf("expected error not to echo the entry, got %v", err)
+	}
+}
+
+func TestKey_LogValueRedactsSecret(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("key", slog.Any("key", Key{ID: "ops", Secret: "hunter2"}))
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("expected secret to be redacted, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "ops") {
+		t.Errorf("expected id to be logged, got: %s", buf.String())
+	}
+}
+
+func TestStaticKeys_Authenticate(t *testing.T) {
+	keys := NewStaticKeys([]Key{{ID: "ops", Secret: "t0ken", Scopes: []string{"admin"}}})
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantID     string
+		wantMethod string
+		wantErr    error
+	}{
+		{"bearer", "Authorization", "Bearer t0ken", "ops", "bearer", nil},
+		{"bearer lowercase scheme", "Authorization", "bearer t0ken", "ops", "bearer", nil},
+		{"api key", "X-API-Key", "t0ken", "ops", "api_key", nil},
+		{"wrong bearer", "Authorization", "Bearer nope", "", "", ErrInvalidCredentials},
+		{"wrong api key", "X-API-Key", "nope", "", "", ErrInvalidCredentials},
+		{"basic auth", "Authorization", "Basic dXNlcjpwYXNz", "", "", ErrNoCredentials},
+		{"none", "", "", "", "", ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			p, err := keys.Authenticate(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if p.ID != tt.wantID || p.Method != tt.wantMethod {
+				t.Errorf("expected %s via %s, got %+v", tt.wantID, tt.wantMethod, p)
+			}
+		})
+	}
+}
+
+func TestStaticKeys_Replace(t *testing.T) {
+	keys := NewStaticKeys([]Key{{ID: "old", Secret: "one"}})
+	keys.Replace([]Key{{ID: "new", Secret: "two"}})
+
+	if keys.Len() != 1 {
+		t.Errorf("expected 1 key, got %d", keys.Len())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "one")
+	if _, err := keys.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected replaced key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package flags provides feature flags: booleans, percentage rollouts and
+// weighted variants, evaluated per request with stable bucketing so that the
+// same caller keeps seeing the same behaviour.
+package flags
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a flag.
+type Kind string
+
+// The kinds of flag, by the form of their value.
+const (
+	// Bool is on or off for everyone: "true" or "false".
+	Bool Kind = "bool"
+	// Percentage is on for a stable share of callers: "25%".
+	Percentage Kind = "percentage"
+	// Variant assigns each caller one of several weighted variants:
+	// "blue:90|green:10", or "blue|green" for equal weights.
+	Variant Kind = "variant"
+)
+
+// Flag is a feature flag definition.
+type Flag struct {
+	Name string
+	Kind Kind
+
+	Enabled    bool
+	Percentage float64
+	Variants   []WeightedVariant
+
+	// Source names where the definition came from, such as env, a file
+	// path or "override".
+	Source string
+}
+
+// WeightedVariant is one variant of a Variant flag.
+type WeightedVariant struct {
+	Name   string
+	Weight int
+}
+
+// Parse parses flag definitions in the form "name=value", separated by
+// commas or newlines. Blank lines and lines starting with '#' are ignored,
+// so the same format works for env vars and files.
+func Parse(s string) ([]Flag, error) {
+	var flags []Flag
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for entry := range strings.SplitSeq(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(entry, "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("flag %q must have the form name=value", entry)
+			}
+			f, err := ParseValue(name, value)
+			if err != nil {
+				return nil, err
+			}
+			flags = append(flags, f)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read flags: %w", err)
+	}
+	return flags, nil
+}
+
+// ParseValue parses the value of flag name, inferring its kind from the
+// form of value.
+func ParseValue(name, value string) (Flag, error) {
+	value = strings.TrimSpace(value)
+	f := Flag{Name: name}
+
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || p < 0 || p > 100 {
+			return Flag{}, fmt.Errorf("flag %s: percentage %q must be between 0%% and 100%%", name, value)
+		}
+		f.Kind, f.Percentage = Percentage, p
+		return f, nil
+	}
+
+	if b, err := strconv.ParseBool(value); err == nil {
+		f.Kind, f.Enabled = Bool, b
+		return f, nil
+	}
+
+	if !strings.Contains(value, "|") {
+		return Flag{}, fmt.Errorf("flag %s: value %q is not a bool, a percentage or variants a|b", name, value)
+	}
+	f.Kind = Variant
+	total := 0
+	for item := range strings.SplitSeq(value, "|") {
+		vname, weight, hasWeight := strings.Cut(strings.TrimSpace(item), ":")
+		v := WeightedVariant{Name: strings.TrimSpace(vname), Weight: 1}
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil || w < 0 {
+				return Flag{}, fmt.Errorf("flag %s: variant %q needs a non-negative integer weight", name, item)
+			}
+			v.Weight = w
+		}
+		if v.Name == "" {
+			return Flag{}, fmt.Errorf("flag %s: empty variant name in %q", name, value)
+		}
+		total += v.Weight
+		f.Variants = append(f.Variants, v)
+	}
+	if total == 0 {
+		return Flag{}, fmt.Errorf("flag %s: variant weights must not all be zero", name)
+	}
+	return f, nil
+}
+
+// Value formats the flag's value in the form Parse accepts.
+func (f Flag) Value() string {
+	switch f.Kind {
+	case Bool:
+		return strconv.FormatBool(f.Enabled)
+	case Percentage:
+		return strconv.FormatFloat(f.Percentage, 'f', -1, 64) + "%"
+	case Variant:
+		parts := make([]string, len(f.Variants))
+		for i, v := range f.Variants {
+			parts[i] = v.Name + ":" + strconv.Itoa(v.Weight)
+		}
+		return strings.Join(parts, "|")
+	}
+	return ""
+}
+
+// bucketSize is the resolution of percentage rollouts: 0.01%.
+const bucketSize = 10000
+
+// bucket maps key to a stable bucket in [0, bucketSize) for flag name.
+// Hashing the flag name in means different flags roll out to different
+// callers.
+func bucket(name, key string) int {
+	sum := sha256.Sum256([]byte(name + "\x00" + key))
+	return int(binary.BigEndian.Uint64(sum[:8]) % bucketSize)
+}
+
+// enabled evaluates the flag as on or off for key. A Variant flag is on
+// when key is assigned any variant but the first.
+func (f Flag) enabled(key string) bool {
+	switch f.Kind {
+	case Bool:
+		return f.Enabled
+	case Percentage:
+		return float64(bucket(f.Name, key)) < f.Percentage*bucketSize/100
+	case Variant:
+		return f.variant(key) != f.Variants[0].Name
+	}
+	return false
+}
+
+// variant returns the variant key is assigned. Bool and Percentage flags
+// have the variants "on" and "off".
+func (f Flag) variant(key string) string {
+	if f.Kind != Variant {
+		if f.enabled(key) {
+			return "on"
+		}
+		return "off"
+	}
+
+	total := 0
+	for _, v := range f.Variants {
+		total += v.Weight
+	}
+	point := bucket(f.Name, key) * total / bucketSize
+	for _, v := range f.Variants {
+		if point < v.Weight {
+			return v.Name
+		}
+		point -= v.Weight
+	}
+	return f.Variants[len(f.Variants)-1].Name
+}
@@ -0,0 +1,127 @@
+package flags
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	got, err := Parse("dark-mode=true, new-checkout=25%\n# comment\n\ntheme=blue:90|green:10\nlayout=grid|list\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"dark-mode bool true",
+		"new-checkout percentage 25%",
+		"theme variant blue:90|green:10",
+		"layout variant grid:1|list:1",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d flags, got %d", len(want), len(got))
+	}
+	for i, f := range got {
+		if s := fmt.Sprintf("%s %s %s", f.Name, f.Kind, f.Value()); s != want[i] {
+			t.Errorf("flag %d: expected %q, got %q", i, want[i], s)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, s := range []string{
+		"no-value",
+		"=true",
+		"rollout=101%",
+		"rollout=-1%",
+		"rollout=abc%",
+		"theme=blue",
+		"theme=blue:x|green",
+		"theme=blue:-1|green:2",
+		"theme=blue:0|green:0",
+		"theme=|green",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestBucket_Stable(t *testing.T) {
+	if bucket("flag", "user-1") != bucket("flag", "user-1") {
+		t.Error("expected the same key to land in the same bucket")
+	}
+
+	// Different flags should not roll out to the same callers.
+	same := 0
+	for i := range 1000 {
+		key := fmt.Sprintf("user-%d", i)
+		if (bucket("a", key) < bucketSize/2) == (bucket("b", key) < bucketSize/2) {
+			same++
+		}
+	}
+	if same > 600 || same < 400 {
+		t.Errorf("expected flags to bucket independently, %d of 1000 agreed", same)
+	}
+}
+
+func TestFlag_PercentageDistribution(t *testing.T) {
+	f, err := ParseValue("rollout", "25%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	on := 0
+	const n = 10000
+	for i := range n {
+		if f.enabled(fmt.Sprintf("client-%d", i)) {
+			on++
+		}
+	}
+	if got := float64(on) / n; math.Abs(got-0.25) > 0.03 {
+		t.Errorf("expected about 25%% enabled, got %.1f%%", got*100)
+	}
+
+	for _, edge := range []string{"0%", "100%"} {
+		f, _ := ParseValue("rollout", edge)
+		want := edge == "100%"
+		for i := range 100 {
+			if got := f.enabled(fmt.Sprintf("client-%d", i)); got != want {
+				t.Fatalf("%s: expected enabled=%v for every caller", edge, want)
+			}
+		}
+	}
+}
+
+func TestFlag_VariantDistribution(t *testing.T) {
+	f, err := ParseValue("theme", "blue:70|green:20|red:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	const n = 10000
+	for i := range n {
+		counts[f.variant(fmt.Sprintf("client-%d", i))]++
+	}
+	for name, want := range map[string]float64{"blue": 0.7, "green": 0.2, "red": 0.1} {
+		if got := float64(counts[name]) / n; math.Abs(got-want) > 0.03 {
+			t.Errorf("expected about %.0f%% %s, got %.1f%%", want*100, name, got*100)
+		}
+	}
+	if f.enabled("x") != (f.variant("x") != "blue") {
+		t.Error("expected a variant flag to be on for every variant but the first")
+	}
+}
+
+func TestFlag_BoolVariant(t *testing.T) {
+	on, _ := ParseValue("a", "true")
+	off, _ := ParseValue("a", "false")
+	if on.variant("k") != "on" || off.variant("k") != "off" {
+		t.Errorf("expected on/off variants, got %q and %q", on.variant("k"), off.variant("k"))
+	}
+	if !strings.Contains(off.Value(), "false") {
+		t.Errorf("unexpected value %q", off.Value())
+	}
+}
@@ -0,0 +1,208 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrUnknownFlag is returned when overriding a flag that is not defined.
+var ErrUnknownFlag = errors.New("unknown flag")
+
+// OverrideSource is the Source of a flag set at runtime.
+const OverrideSource = "override"
+
+// Set holds the flags in effect: the configured definitions, replaced on
+// every config reload, and runtime overrides, which take precedence until
+// cleared and last until the process exits. Every change to an effective
+// flag is logged. It is safe for concurrent use.
+type Set struct {
+	logger *slog.Logger
+
+	mu        sync.RWMutex
+	base      map[string]Flag
+	overrides map[string]Flag
+}
+
+// NewSet returns a Set of the configured flags.
+func NewSet(logger *slog.Logger, flags []Flag) *Set {
+	return &Set{logger: logger, base: index(flags), overrides: map[string]Flag{}}
+}
+
+func index(flags []Flag) map[string]Flag {
+	m := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		m[f.Name] = f
+	}
+	return m
+}
+
+// effective returns the flag in effect for name. s.mu must be held.
+func (s *Set) effective(name string) (Flag, bool) {
+	if f, ok := s.overrides[name]; ok {
+		return f, true
+	}
+	f, ok := s.base[name]
+	return f, ok
+}
+
+// Replace swaps the configured flags, keeping runtime overrides, and logs
+// the flags whose effective value changed.
+func (s *Set) Replace(flags []Flag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := make(map[string]Flag, len(s.base))
+	for name := range s.base {
+		old[name], _ = s.effective(name)
+	}
+	s.base = index(flags)
+	// Overrides of flags no longer defined are dropped with them.
+	for name := range s.overrides {
+		if _, ok := s.base[name]; !ok {
+			delete(s.overrides, name)
+		}
+	}
+
+	names := maps.Clone(old)
+	maps.Copy(names, s.base)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		prev, hadPrev := old[name]
+		next, hasNext := s.effective(name)
+		if hadPrev != hasNext || prev.Value() != next.Value() || prev.Source != next.Source {
+			s.logChange(name, prev, hadPrev, next, hasNext, "config")
+		}
+	}
+}
+
+// Override sets flag name to value at runtime. by identifies who made the
+// change, for the log.
+func (s *Set) Override(name, value, by string) (Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.effective(name)
+	if !ok {
+		return Flag{}, fmt.Errorf("%w %s", ErrUnknownFlag, name)
+	}
+	f, err := ParseValue(name, value)
+	if err != nil {
+		return Flag{}, err
+	}
+	f.Source = OverrideSource
+	s.overrides[name] = f
+	s.logChange(name, prev, true, f, true, by)
+	return f, nil
+}
+
+// ClearOverride removes the runtime override of flag name, returning the
+// configured flag now in effect.
+func (s *Set) ClearOverride(name, by string) (Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.effective(name)
+	if !ok {
+		return Flag{}, fmt.Errorf("%w %s", ErrUnknownFlag, name)
+	}
+	delete(s.overrides, name)
+	next := s.base[name]
+	if prev.Source == OverrideSource {
+		s.logChange(name, prev, true, next, true, by)
+	}
+	return next, nil
+}
+
+func (s *Set) logChange(name string, prev Flag, hadPrev bool, next Flag, hasNext bool, by string) {
+	attrs := []slog.Attr{slog.String("flag", name), slog.String("by", by)}
+	if hadPrev {
+		attrs = append(attrs, slog.String("old", prev.Value()), slog.String("old_source", prev.Source))
+	}
+	if hasNext {
+		attrs = append(attrs, slog.String("new", next.Value()), slog.String("source", next.Source))
+	}
+	s.logger.LogAttrs(context.Background(), slog.LevelInfo, "feature flag changed", attrs...)
+}
+
+// Status is a flag in effect and, when it is overridden, the configured
+// definition underneath.
+type Status struct {
+	Flag
+	Configured *Flag
+}
+
+// List returns the flags in effect, sorted by name.
+func (s *Set) List() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Status, 0, len(s.base))
+	for _, name := range slices.Sorted(maps.Keys(s.base)) {
+		st := Status{Flag: s.base[name]}
+		if o, ok := s.overrides[name]; ok {
+			base := st.Flag
+			st.Flag, st.Configured = o, &base
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Get returns the flag in effect for name.
+func (s *Set) Get(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.effective(name)
+}
+
+// For returns an Evaluator that buckets by key, such as a user or client
+// id. Callers with the same key get the same results.
+func (s *Set) For(key string) Evaluator {
+	return Evaluator{set: s, key: key}
+}
+
+// Evaluator evaluates flags for one caller. The zero Evaluator reports
+// every flag as off.
+type Evaluator struct {
+	set *Set
+	key string
+}
+
+// Enabled reports whether flag name is on for the caller. Unknown flags
+// are off.
+func (e Evaluator) Enabled(name string) bool {
+	if e.set == nil {
+		return false
+	}
+	f, ok := e.set.Get(name)
+	return ok && f.enabled(e.key)
+}
+
+// Variant returns the variant of flag name assigned to the caller, "on" or
+// "off" for other kinds of flag, and "" for unknown flags.
+func (e Evaluator) Variant(name string) string {
+	if e.set == nil {
+		return ""
+	}
+	f, ok := e.set.Get(name)
+	if !ok {
+		return ""
+	}
+	return f.variant(e.key)
+}
+
+type evaluatorKey struct{}
+
+// NewContext returns a copy of ctx carrying e.
+func NewContext(ctx context.Context, e Evaluator) context.Context {
+	return context.WithValue(ctx, evaluatorKey{}, e)
+}
+
+// FromContext returns the Evaluator for the request carrying ctx, or the
+// zero Evaluator.
+func FromContext(ctx context.Context) Evaluator {
+	e, _ := ctx.Value(evaluatorKey{}).(Evaluator)
+	return e
+}
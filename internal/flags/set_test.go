@@ -0,0 +1,125 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestSet(t *testing.T, spec string) (*Set, *bytes.Buffer) {
+	t.Helper()
+	defs, err := Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range defs {
+		defs[i].Source = "env"
+	}
+	var buf bytes.Buffer
+	return NewSet(slog.New(slog.NewTextHandler(&buf, nil)), defs), &buf
+}
+
+func TestSet_Override(t *testing.T) {
+	s, logs := newTestSet(t, "dark-mode=false")
+	e := s.For("user-1")
+
+	if e.Enabled("dark-mode") {
+		t.Fatal("expected dark-mode to start off")
+	}
+	if _, err := s.Override("dark-mode", "true", "ops"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !e.Enabled("dark-mode") {
+		t.Error("expected the override to take effect")
+	}
+	if out := logs.String(); !strings.Contains(out, `msg="feature flag changed" flag=dark-mode by=ops old=false old_source=env new=true source=override`) {
+		t.Errorf("expected the change to be logged, got:\n%s", out)
+	}
+
+	list := s.List()
+	if len(list) != 1 || list[0].Source != OverrideSource || list[0].Configured == nil || list[0].Configured.Enabled {
+		t.Errorf("expected the list to show the override over the configured flag, got %+v", list)
+	}
+
+	f, err := s.ClearOverride("dark-mode", "ops")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Enabled || e.Enabled("dark-mode") {
+		t.Error("expected the configured value back after clearing the override")
+	}
+}
+
+func TestSet_OverrideErrors(t *testing.T) {
+	s, _ := newTestSet(t, "dark-mode=false")
+
+	if _, err := s.Override("missing", "true", "ops"); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+	if _, err := s.ClearOverride("missing", "ops"); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+	if _, err := s.Override("dark-mode", "maybe", "ops"); err == nil {
+		t.Error("expected an invalid value to be rejected")
+	}
+}
+
+func TestSet_Replace(t *testing.T) {
+	s, logs := newTestSet(t, "a=true,b=false,c=true")
+	if _, err := s.Override("c", "false", "ops"); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+
+	next, _ := Parse("a=true,b=50%,c=true,d=true")
+	for i := range next {
+		next[i].Source = "env"
+	}
+	s.Replace(next)
+
+	out := logs.String()
+	for _, want := range []string{"flag=b by=config old=false", "new=50%", "flag=d by=config new=true"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"flag=a", "flag=c"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected no change logged for %s, got:\n%s", unwanted, out)
+		}
+	}
+	if f, _ := s.Get("c"); f.Source != OverrideSource {
+		t.Error("expected the override to survive a reload")
+	}
+
+	logs.Reset()
+	s.Replace(nil)
+	if _, ok := s.Get("c"); ok {
+		t.Error("expected overrides of removed flags to go with them")
+	}
+	if out := logs.String(); !strings.Contains(out, "flag=c by=config old=false old_source=override\n") {
+		t.Errorf("expected the removal of the overridden flag to be logged, got:\n%s", out)
+	}
+}
+
+func TestEvaluator_Context(t *testing.T) {
+	s, _ := newTestSet(t, "theme=blue|green")
+
+	if FromContext(context.Background()).Enabled("theme") {
+		t.Error("expected the zero Evaluator to report flags off")
+	}
+	if v := FromContext(context.Background()).Variant("theme"); v != "" {
+		t.Errorf("expected no variant from the zero Evaluator, got %q", v)
+	}
+
+	ctx := NewContext(context.Background(), s.For("user-1"))
+	if v := FromContext(ctx).Variant("theme"); v != s.For("user-1").Variant("theme") || v == "" {
+		t.Errorf("expected a stable variant for the caller, got %q", v)
+	}
+	if v := FromContext(ctx).Variant("missing"); v != "" {
+		t.Errorf("expected no variant for an unknown flag, got %q", v)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+)
+
+// Authenticate returns middleware that resolves the caller with authn and
+// stores the principal in the request context and the request log. Requests
+// without credentials continue anonymously so that RequireAuth can apply
+// per-route policy; requests with bad credentials are rejected with 401.
+func Authenticate(logger *slog.Logger, authn auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := authn.Authenticate(r)
+			switch {
+			case errors.Is(err, auth.ErrNoCredentials):
+				next.ServeHTTP(w, r)
+				return
+			case err != nil:
+				logger.Warn("authentication failed",
+					slog.String("path", r.URL.Path),
+					slog.String("client_ip", ClientIP(r)),
+					slog.String("error", err.Error()),
+				)
+				unauthorized(w, "invalid credentials")
+				return
+			}
+
+			AddLogAttrs(r.Context(),
+				slog.String("principal", p.ID),
+				slog.String("auth_method", p.Method),
+			)
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		})
+	}
+}
+
+// RequireAuth returns middleware that rejects anonymous requests with 401
+// and principals lacking any of scopes with 403.
+func RequireAuth(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+			if !p.HasScopes(scopes...) {
+				writeError(w, http.StatusForbidden, "insufficient scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gitops-demo"`)
+	writeError(w, http.StatusUnauthorized, msg)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+)
+
+func authTestHandler(logger *slog.Logger, scopes ...string) http.Handler {
+	keys := auth.NewStaticKeys([]auth.Key{
+		{ID: "reader", Secret: "read-key"},
+		{ID: "ops", Secret: "ops-key", Scopes: []string{"admin"}},
+	})
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.FromContext(r.Context())
+		_, _ = w.Write([]byte(p.ID))
+	})
+	return RequestLogger(logger)(Authenticate(logger, keys)(RequireAuth(scopes...)(inner)))
+}
+
+func TestAuth_Statuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		key        string
+		wantStatus int
+	}{
+		{"anonymous", nil, "", http.StatusUnauthorized},
+		{"invalid key", nil, "wrong", http.StatusUnauthorized},
+		{"valid key", nil, "read-key", http.StatusOK},
+		{"missing scope", []string{"admin"}, "read-key", http.StatusForbidden},
+		{"has scope", []string{"admin"}, "ops-key", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rec := httptest.NewRecorder()
+			authTestHandler(discardLogger(), tt.scopes...).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK && rec.Header().Get("Content-Type") != "application/json" {
+				t.Error("expected JSON error body")
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
+
+func TestAuth_PrincipalInContextAndLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "ops-key")
+	rec := httptest.NewRecorder()
+	authTestHandler(logger).ServeHTTP(rec, req)
+
+	if rec.Body.String() != "ops" {
+		t.Errorf("expected principal %q in context, got %q", "ops", rec.Body.String())
+	}
+	if !strings.Contains(buf.String(), "principal=ops") {
+		t.Errorf("expected log to contain principal=ops, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "auth_method=api_key") {
+		t.Errorf("expected log to contain auth_method=api_key, got: %s", buf.String())
+	}
+}
+
+func TestAuthenticate_AnonymousContinues(t *testing.T) {
+	keys := auth.NewStaticKeys(nil)
+	called := false
+	handler := Authenticate(discardLogger(), keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !called {
+		t.Error("expected anonymous request to reach the handler")
+	}
+}
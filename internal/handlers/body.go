@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MaxBodySize returns middleware that limits request bodies to n bytes.
+// Reads of a body whose declared Content-Length exceeds the limit fail at
+// once, and reads past the limit of any other body fail, both with
+// *http.MaxBytesError, which decodeJSON answers with 413.
+//
+// The limit is kept in the request context and checked when the body is
+// read, so a MaxBodySize nearer the handler, such as one added to a single
+// route with r.With, replaces the limit of one applied to the whole group,
+// whether it is lower or higher.
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l, ok := r.Context().Value(bodyLimitKey{}).(*bodyLimit); ok {
+				l.n = n
+				next.ServeHTTP(w, r)
+				return
+			}
+			l := &bodyLimit{n: n}
+			r = r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, l))
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{w: w, body: r.Body, declared: r.ContentLength, limit: l}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type bodyLimitKey struct{}
+
+// bodyLimit is the body limit in effect for a request.
+type bodyLimit struct {
+	n int64
+}
+
+// limitedBody applies the request's body limit on the first read, once
+// every MaxBodySize on the route has had its say.
+type limitedBody struct {
+	w        http.ResponseWriter
+	body     io.ReadCloser
+	declared int64
+	limit    *bodyLimit
+	r        io.ReadCloser
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		if b.declared > b.limit.n {
+			return 0, &http.MaxBytesError{Limit: b.limit.n}
+		}
+		b.r = http.MaxBytesReader(b.w, b.body, b.limit.n)
+	}
+	return b.r.Read(p)
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// RequireContentType returns middleware that rejects requests carrying a body
+// with 415 unless their Content-Type media type is one of types. Requests
+// without a body are always allowed through.
+func RequireContentType(types ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err == nil {
+				for _, t := range types {
+					if strings.EqualFold(mediaType, t) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			writeError(w, http.StatusUnsupportedMediaType,
+				fmt.Sprintf("unsupported content type, expected %s", strings.Join(types, " or ")))
+		})
+	}
+}
+
+// decodeJSON decodes the request body into v. On failure it writes the
+// appropriate error response (413 for oversized bodies, 400 otherwise) and
+// returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		return true
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit))
+		return false
+	}
+	writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+	return false
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize_RejectsDeclaredLength(t *testing.T) {
+	body := &countingReader{r: strings.NewReader(`{"name":"too long"}`)}
+	handler := MaxBodySize(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			Name string `json:"name"`
+		}
+		decodeJSON(w, r, &v)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.ContentLength = 19
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if body.n != 0 {
+		t.Errorf("expected the body not to be read, read %d bytes", body.n)
+	}
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type %q, got %q", "application/json", ct)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestMaxBodySize_RouteReplacesGroupLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		group, route  int64
+		body          string
+		declareLength bool
+		wantErr       bool
+	}{
+		{"raised, declared", 4, 64, "larger than four", true, false},
+		{"raised, chunked", 4, 64, "larger than four", false, false},
+		{"lowered, declared", 64, 4, "larger than four", true, true},
+		{"lowered, chunked", 64, 4, "larger than four", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readErr error
+			handler := MaxBodySize(tt.group)(MaxBodySize(tt.route)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			})))
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if !tt.declareLength {
+				req.ContentLength = -1
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var maxErr *http.MaxBytesError
+			if got := errors.As(readErr, &maxErr); got != tt.wantErr {
+				t.Fatalf("expected *http.MaxBytesError=%v, got %v", tt.wantErr, readErr)
+			}
+			if tt.wantErr && maxErr.Limit != tt.route {
+				t.Errorf("expected limit %d, got %d", tt.route, maxErr.Limit)
+			}
+		})
+	}
+}
+
+func TestMaxBodySize_LimitsUndeclaredLength(t *testing.T) {
+	var readErr error
+	handler := MaxBodySize(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long"))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) {
+		t.Errorf("expected *http.MaxBytesError, got %v", readErr)
+	}
+}
+
+func TestMaxBodySize_AllowsSmallBody(t *testing.T) {
+	var body []byte
+	handler := MaxBodySize(64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("ok")))
+
+	if string(body) != "ok" {
+		t.Errorf("expected body %q, got %q", "ok", body)
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantStatus  int
+	}{
+		{"no body", "", "", http.StatusOK},
+		{"json", "{}", "application/json", http.StatusOK},
+		{"json with charset", "{}", "application/json; charset=utf-8", http.StatusOK},
+		{"mixed case", "{}", "Application/JSON", http.StatusOK},
+		{"wrong type", "a=b", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"missing type", "{}", "", http.StatusUnsupportedMediaType},
+	}
+
+	handler := RequireContentType("application/json")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		limit      int64
+		wantOK     bool
+		wantStatus int
+	}{
+		{"valid", `{"name":"x"}`, 64, true, http.StatusOK},
+		{"malformed", `{"name":`, 64, false, http.StatusBadRequest},
+		{"unknown field", `{"other":1}`, 64, false, http.StatusBadRequest},
+		{"too large", `{"name":"xxxxxxxxxxxxxxxx"}`, 8, false, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct {
+				Name string `json:"name"`
+			}
+			var ok bool
+			handler := MaxBodySize(tt.limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ok = decodeJSON(w, r, &v)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if ok != tt.wantOK {
+				t.Errorf("expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if !ok {
+				var resp ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error == "" {
+					t.Errorf("expected JSON error body, got %q", rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressConfig configures the Compress middleware.
+type CompressConfig struct {
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	MinSize int
+	// ContentTypes lists the media types that may be compressed. Entries
+	// ending in "/*" match a whole type, e.g. "text/*".
+	ContentTypes []string
+}
+
+// encoder is implemented by the gzip, brotli and zstd writers.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// encoderPools holds reusable encoders in server preference order, which
+// decides between encodings the client rates equally.
+var encoderPools = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"zstd", &sync.Pool{New: func() any {
+		// Errors are only returned for invalid options.
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}}},
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, 5) }}},
+	{"gzip", &sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+}
+
+// Compress returns middleware that compresses responses with zstd, brotli
+// or gzip as negotiated through Accept-Encoding. Responses smaller than
+// MinSize, of a type not in ContentTypes, or already encoded by the handler
+// are sent unchanged. It must run inside RequestLogger so that logged byte
+// counts reflect what was sent on the wire.
+func Compress(cfg CompressConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			idx := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if idx < 0 || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: &cfg, encoding: idx}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the index into encoderPools of the encoding the
+// client prefers, or -1 if it accepts none of them. A "*" entry covers only
+// the encodings the header does not name, so one refused with q=0 stays
+// refused.
+func negotiateEncoding(header string) int {
+	named := make([]float64, len(encoderPools))
+	isNamed := make([]bool, len(encoderPools))
+	wildcard := 0.0
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		for i, e := range encoderPools {
+			if strings.EqualFold(name, e.name) {
+				named[i], isNamed[i] = q, true
+				break
+			}
+		}
+	}
+
+	best, bestQ := -1, 0.0
+	for i := range encoderPools {
+		q := wildcard
+		if isNamed[i] {
+			q = named[i]
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// the body is large enough and of the right type to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *CompressConfig
+	encoding int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		// Informational responses precede the real one; pass them on.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(p), nil
+		}
+		buffered := cw.buf
+		cw.buf = nil
+		if err := cw.start(buffered, cw.compressible()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends any buffered data, committing to a decision early.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		buffered := cw.buf
+		cw.buf = nil
+		_ = cw.start(buffered, cw.compressible() && len(buffered) >= cw.cfg.MinSize)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range cw.cfg.ContentTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(mediaType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide commits to compressing or not without writing a body.
+func (cw *compressWriter) decide(compress bool) {
+	_ = cw.start(nil, compress)
+}
+
+// start sends the headers and any buffered body, through an encoder if
+// compress is set.
+func (cw *compressWriter) start(buffered []byte, compress bool) error {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", encoderPools[cw.encoding].name)
+		h.Del("Content-Length")
+		cw.enc = encoderPools[cw.encoding].pool.Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(buffered) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buffered)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buffered)
+	return err
+}
+
+// close finishes the response once the handler returns.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			// The handler wrote nothing; let net/http send its default.
+			return
+		}
+		buffered := cw.buf
+		cw.buf = nil
+		_ = cw.start(buffered, false)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		encoderPools[cw.encoding].pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
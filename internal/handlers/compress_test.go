@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func testCompressConfig() CompressConfig {
+	return CompressConfig{
+		MinSize:      256,
+		ContentTypes: []string{"application/json", "text/*"},
+	}
+}
+
+// largeJSON is comfortably above the test MinSize and compresses well.
+var largeJSON = `{"items":[` + strings.Repeat(`{"name":"gitops-demo","status":"ok"},`, 50) + `{}]}`
+
+func jsonHandler(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func serveCompressed(cfg CompressConfig, h http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	Compress(cfg)(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("zstd reader: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return string(body)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompress %s: %v", encoding, err)
+	}
+	return string(out)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                              "",
+		"identity":                      "",
+		"gzip":                          "gzip",
+		"gzip, deflate, br":             "br",
+		"gzip, br, zstd":                "zstd",
+		"br;q=0.5, gzip;q=0.8":          "gzip",
+		"zstd;q=0, gzip":                "gzip",
+		"*":                             "zstd",
+		"gzip;q=0.9, *;q=0.1":           "gzip",
+		"GZIP":                          "gzip",
+		"gzip;q=bogus, br;q=0.1":        "br",
+		"zstd;q=0, *":                   "br",
+		"br;q=0, zstd;q=0, *":           "gzip",
+		"gzip;q=0, br;q=0, zstd;q=0, *": "",
+		"*;q=0.5, gzip":                 "gzip",
+	}
+
+	for header, want := range tests {
+		t.Run(header, func(t *testing.T) {
+			got := ""
+			if idx := negotiateEncoding(header); idx >= 0 {
+				got = encoderPools[idx].name
+			}
+			if got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestCompress_Encodings(t *testing.T) {
+	for _, enc := range []string{"gzip", "br", "zstd"} {
+		t.Run(enc, func(t *testing.T) {
+			// Run twice so the second request reuses a pooled encoder.
+			for range 2 {
+				rec := serveCompressed(testCompressConfig(), jsonHandler(http.StatusCreated, largeJSON), enc)
+
+				if rec.Code != http.StatusCreated {
+					t.Errorf("expected status %d, got %d", http.StatusCreated, rec.Code)
+				}
+				if got := rec.Header().Get("Content-Encoding"); got != enc {
+					t.Fatalf("expected Content-Encoding %q, got %q", enc, got)
+				}
+				if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+					t.Errorf("expected Vary %q, got %q", "Accept-Encoding", got)
+				}
+				if rec.Body.Len() >= len(largeJSON) {
+					t.Errorf("expected compressed body smaller than %d, got %d", len(largeJSON), rec.Body.Len())
+				}
+				if got := decompress(t, enc, rec.Body.Bytes()); got != largeJSON {
+					t.Error("decompressed body does not match")
+				}
+			}
+		})
+	}
+}
+
+func TestCompress_Skips(t *testing.T) {
+	tests := map[string]struct {
+		handler        http.HandlerFunc
+		acceptEncoding string
+		wantBody       string
+	}{
+		"no accept-encoding": {jsonHandler(http.StatusOK, largeJSON), "", largeJSON},
+		"below min size":     {jsonHandler(http.StatusOK, `{"status":"ok"}`), "gzip", `{"status":"ok"}`},
+		"type not allowed": {func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, largeJSON)
+		}, "gzip", largeJSON},
+		"already encoded": {func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "custom")
+			_, _ = io.WriteString(w, largeJSON)
+		}, "gzip", largeJSON},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := serveCompressed(testCompressConfig(), tt.handler, tt.acceptEncoding)
+
+			if enc := rec.Header().Get("Content-Encoding"); enc != "" && enc != "custom" {
+				t.Errorf("expected no compression, got Content-Encoding %q", enc)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("expected body to pass through unchanged, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompress_SmallWritesAccumulate(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for range 100 {
+			_, _ = io.WriteString(w, "0123456789")
+		}
+	}
+
+	rec := serveCompressed(testCompressConfig(), http.HandlerFunc(handler), "gzip")
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected gzip, got %q", got)
+	}
+	if got := decompress(t, "gzip", rec.Body.Bytes()); got != strings.Repeat("0123456789", 100) {
+		t.Error("decompressed body does not match")
+	}
+}
+
+func TestCompress_StatusWithoutBody(t *testing.T) {
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			rec := serveCompressed(testCompressConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}), "gzip")
+
+			if rec.Code != status {
+				t.Errorf("expected status %d, got %d", status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("expected no Content-Encoding, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCompress_Flush(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, largeJSON)
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush failed: %v", err)
+		}
+	}
+
+	rec := serveCompressed(testCompressConfig(), http.HandlerFunc(handler), "gzip")
+
+	if !rec.Flushed {
+		t.Error("expected underlying writer to be flushed")
+	}
+	if got := decompress(t, "gzip", rec.Body.Bytes()); got != largeJSON {
+		t.Error("decompressed body does not match")
+	}
+}
+
+func TestCompress_LoggedBytesAndStatus(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	handler := RequestLogger(logger)(Compress(testCompressConfig())(jsonHandler(http.StatusAccepted, largeJSON)))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	logOutput := buf.String()
+	if !strings.Contains(logOutput, "status=202") {
+		t.Errorf("expected log to contain status=202, got: %s", logOutput)
+	}
+	if want := fmt.Sprintf("bytes=%d", rec.Body.Len()); !strings.Contains(logOutput, want) {
+		t.Errorf("expected log to contain %s (compressed size), got: %s", want, logOutput)
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, enc := range []string{"gzip", "br", "zstd"} {
+		b.Run(enc, func(b *testing.B) {
+			handler := Compress(testCompressConfig())(jsonHandler(http.StatusOK, largeJSON))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", enc)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ConcurrencyLimitConfig configures the adaptive concurrency limiter.
+type ConcurrencyLimitConfig struct {
+	// InitialLimit is the number of in-flight requests allowed at startup.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the adaptive limit.
+	MinLimit int
+	MaxLimit int
+	// LatencyTarget is the request latency above which the limit backs off.
+	LatencyTarget time.Duration
+	// Backoff is the multiplicative decrease applied when a request is
+	// slower than LatencyTarget. It must be between 0 and 1.
+	Backoff float64
+}
+
+// ConcurrencyLimiter caps the number of in-flight requests using an
+// additive-increase/multiplicative-decrease (AIMD) limit driven by observed
+// request latency. While requests complete within the latency target the
+// limit grows by roughly one per limit's worth of requests; when a request
+// overruns the target the limit is multiplied by the backoff factor.
+type ConcurrencyLimiter struct {
+	cfg ConcurrencyLimitConfig
+	now func() time.Time
+
+	mu           sync.Mutex
+	limit        float64
+	inflight     int
+	lastDecrease time.Time
+
+	limitGauge    prometheus.Gauge
+	inflightGauge prometheus.Gauge
+	rejected      prometheus.Counter
+}
+
+// NewConcurrencyLimiter creates a limiter and registers its metrics with reg.
+// A nil reg leaves the metrics unregistered.
+func NewConcurrencyLimiter(cfg ConcurrencyLimitConfig, reg prometheus.Registerer) *ConcurrencyLimiter {
+	factory := promauto.With(reg)
+	l := &ConcurrencyLimiter{
+		cfg:   cfg,
+		now:   time.Now,
+		limit: float64(cfg.InitialLimit),
+		limitGauge: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gitops_demo_concurrency_limit",
+			Help: "Current adaptive limit on in-flight requests.",
+		}),
+		inflightGauge: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gitops_demo_concurrency_inflight",
+			Help: "Number of requests currently admitted by the concurrency limiter.",
+		}),
+		rejected: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gitops_demo_concurrency_rejected_total",
+			Help: "Total requests rejected because the concurrency limit was reached.",
+		}),
+	}
+	l.limitGauge.Set(l.limit)
+	return l
+}
+
+// SetConfig replaces the limiter's settings, clamping the current limit to
+// the new bounds. InitialLimit is ignored since the limiter is already
+// running.
+func (l *ConcurrencyLimiter) SetConfig(cfg ConcurrencyLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+	l.limit = math.Min(math.Max(l.limit, float64(cfg.MinLimit)), float64(cfg.MaxLimit))
+	l.limitGauge.Set(math.Floor(l.limit))
+}
+
+// Limit returns the current concurrency limit.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Middleware rejects requests with 503 once the current limit is reached and
+// feeds the latency of admitted requests back into the limit.
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire() {
+			l.rejected.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "server is at capacity")
+			return
+		}
+
+		start := l.now()
+		defer func() { l.release(l.now().Sub(start)) }()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *ConcurrencyLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	l.inflightGauge.Set(float64(l.inflight))
+	return true
+}
+
+func (l *ConcurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	utilised := l.inflight
+	l.inflight--
+	l.inflightGauge.Set(float64(l.inflight))
+
+	now := l.now()
+	switch {
+	case latency > l.cfg.LatencyTarget:
+		// A burst of slow requests completing together reflects a single
+		// overload event, so back off at most once per latency target.
+		if now.Sub(l.lastDecrease) < l.cfg.LatencyTarget {
+			return
+		}
+		l.limit = math.Max(float64(l.cfg.MinLimit), l.limit*l.cfg.Backoff)
+		l.lastDecrease = now
+	case float64(utilised)*2 >= l.limit:
+		// Only grow when the limit is actually being used; otherwise an idle
+		// service would drift up to MaxLimit and lose its protection.
+		l.limit = math.Min(float64(l.cfg.MaxLimit), l.limit+1/l.limit)
+	default:
+		return
+	}
+	l.limitGauge.Set(math.Floor(l.limit))
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testLimiterConfig() ConcurrencyLimitConfig {
+	return ConcurrencyLimitConfig{
+		InitialLimit:  10,
+		MinLimit:      2,
+		MaxLimit:      20,
+		LatencyTarget: 100 * time.Millisecond,
+		Backoff:       0.5,
+	}
+}
+
+// fakeClock is a clock whose time only moves when Advance is called.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestConcurrencyLimiter_RejectsAtLimit(t *testing.T) {
+	cfg := testLimiterConfig()
+	cfg.InitialLimit = 1
+	cfg.MinLimit = 1
+	reg := prometheus.NewRegistry()
+	l := NewConcurrencyLimiter(cfg, reg)
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	close(release)
+	<-done
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header to be set")
+	}
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Error == "" {
+		t.Error("expected error message to be non-empty")
+	}
+
+	if got := testutil.ToFloat64(l.rejected); got != 1 {
+		t.Errorf("expected 1 rejection, got %v", got)
+	}
+}
+
+func TestConcurrencyLimiter_BacksOffOnSlowRequests(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := NewConcurrencyLimiter(testLimiterConfig(), nil)
+	l.now = clock.Now
+
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(time.Second)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := l.Limit(); got != 5 {
+		t.Errorf("expected limit 5 after one slow request, got %d", got)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := l.Limit(); got != 2 {
+		t.Errorf("expected limit to stop at MinLimit 2, got %d", got)
+	}
+	if got := testutil.ToFloat64(l.limitGauge); got != 2 {
+		t.Errorf("expected limit gauge 2, got %v", got)
+	}
+}
+
+func TestConcurrencyLimiter_SingleBackoffPerOverload(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := NewConcurrencyLimiter(testLimiterConfig(), nil)
+	l.now = clock.Now
+
+	// Two slow completions within one latency target count as one overload.
+	clock.Advance(time.Second)
+	l.acquire()
+	l.acquire()
+	l.release(time.Second)
+	l.release(time.Second)
+
+	if got := l.Limit(); got != 5 {
+		t.Errorf("expected a single backoff to limit 5, got %d", got)
+	}
+}
+
+func TestConcurrencyLimiter_GrowsWhenUtilised(t *testing.T) {
+	cfg := testLimiterConfig()
+	cfg.InitialLimit = 2
+	l := NewConcurrencyLimiter(cfg, nil)
+
+	// Saturate the limit with fast requests on every round.
+	for range 200 {
+		n := l.Limit()
+		for range n {
+			l.acquire()
+		}
+		for range n {
+			l.release(time.Millisecond)
+		}
+	}
+
+	if got := l.Limit(); got != cfg.MaxLimit {
+		t.Errorf("expected limit to grow to MaxLimit %d, got %d", cfg.MaxLimit, got)
+	}
+}
+
+func TestConcurrencyLimiter_DoesNotGrowWhenIdle(t *testing.T) {
+	l := NewConcurrencyLimiter(testLimiterConfig(), nil)
+
+	for range 100 {
+		l.acquire()
+		l.release(time.Millisecond)
+	}
+
+	if got := l.Limit(); got != 10 {
+		t.Errorf("expected limit to stay at 10, got %d", got)
+	}
+}
+
+func TestConcurrencyLimiter_SetConfigClampsLimit(t *testing.T) {
+	l := NewConcurrencyLimiter(testLimiterConfig(), nil)
+
+	cfg := testLimiterConfig()
+	cfg.MaxLimit = 4
+	l.SetConfig(cfg)
+	if got := l.Limit(); got != 4 {
+		t.Errorf("expected limit clamped to new MaxLimit 4, got %d", got)
+	}
+	if got := testutil.ToFloat64(l.limitGauge); got != 4 {
+		t.Errorf("expected limit gauge 4, got %v", got)
+	}
+
+	cfg.MinLimit, cfg.MaxLimit = 8, 16
+	l.SetConfig(cfg)
+	if got := l.Limit(); got != 8 {
+		t.Errorf("expected limit raised to new MinLimit 8, got %d", got)
+	}
+}
+
+// BenchmarkConcurrencyLimiter drives the limiter with a synthetic handler
+// whose latency grows with concurrency, so the limit converges under
+// parallel load. Run with -cpu to vary the offered concurrency.
+func BenchmarkConcurrencyLimiter(b *testing.B) {
+	cfg := ConcurrencyLimitConfig{
+		InitialLimit:  50,
+		MinLimit:      1,
+		MaxLimit:      500,
+		LatencyTarget: time.Millisecond,
+		Backoff:       0.9,
+	}
+	l := NewConcurrencyLimiter(cfg, nil)
+
+	var mu sync.Mutex
+	inflight := 0
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Latency grows with the number of concurrent requests, like a
+		// backend that saturates.
+		mu.Lock()
+		inflight++
+		n := inflight
+		mu.Unlock()
+
+		time.Sleep(time.Duration(n) * 50 * time.Microsecond)
+
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+	}))
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+	})
+	b.StopTimer()
+
+	b.ReportMetric(float64(l.Limit()), "limit")
+	b.ReportMetric(testutil.ToFloat64(l.rejected), "rejected")
+}
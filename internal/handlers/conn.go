@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ConnConfig limits how long a client connection is kept alive.
+type ConnConfig struct {
+	// MaxRequests is the number of requests served on a connection before
+	// it is closed. Zero means no limit.
+	MaxRequests int
+	// MaxAge is how long a connection is reused for before it is closed.
+	// Zero means no limit.
+	MaxAge time.Duration
+}
+
+// ConnTracker records connection metrics from http.Server.ConnState and
+// recycles keep-alive connections that reach their request or age limit, so
+// that clients spread over new replicas after a scale-up. Wire ConnState and
+// ConnContext into the server and wrap its handler with Middleware.
+type ConnTracker struct {
+	cfg ConnConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+
+	opened   prometheus.Counter
+	closed   prometheus.Counter
+	current  *prometheus.GaugeVec
+	recycled *prometheus.CounterVec
+}
+
+// NewConnTracker creates a tracker and registers its metrics with reg.
+// A nil reg leaves the metrics unregistered.
+func NewConnTracker(cfg ConnConfig, reg prometheus.Registerer) *ConnTracker {
+	factory := promauto.With(reg)
+	return &ConnTracker{
+		cfg:    cfg,
+		now:    time.Now,
+		states: make(map[net.Conn]http.ConnState),
+		opened: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gitops_demo_connections_opened_total",
+			Help: "Total client connections accepted.",
+		}),
+		closed: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gitops_demo_connections_closed_total",
+			Help: "Total client connections closed or hijacked.",
+		}),
+		current: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gitops_demo_connections",
+			Help: "Open client connections by state (new, active, idle).",
+		}, []string{"state"}),
+		recycled: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gitops_demo_connections_recycled_total",
+			Help: "Connections closed after reaching their request or age limit, by reason.",
+		}, []string{"reason"}),
+	}
+}
+
+// ConnState is an http.Server.ConnState hook.
+func (t *ConnTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.states[c]; ok {
+		t.current.WithLabelValues(prev.String()).Dec()
+	}
+
+	switch state {
+	case http.StateNew:
+		t.opened.Inc()
+	case http.StateClosed, http.StateHijacked:
+		delete(t.states, c)
+		t.closed.Inc()
+		return
+	}
+	t.states[c] = state
+	t.current.WithLabelValues(state.String()).Inc()
+}
+
+// connInfoKey is the context key for the connInfo stored by ConnContext.
+type connInfoKey struct{}
+
+// connInfo tracks a connection's age and the requests served on it.
+type connInfo struct {
+	opened   time.Time
+	requests atomic.Int64
+}
+
+// ConnContext is an http.Server.ConnContext hook that records when each
+// connection was opened.
+func (t *ConnTracker) ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, &connInfo{opened: t.now()})
+}
+
+// Middleware asks the server to close the connection after this response,
+// with Connection: close, once it has served MaxRequests requests or is
+// older than MaxAge.
+func (t *ConnTracker) Middleware(next http.Handler) http.Handler {
+	if t.cfg.MaxRequests <= 0 && t.cfg.MaxAge <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ci, ok := r.Context().Value(connInfoKey{}).(*connInfo); ok {
+			n := ci.requests.Add(1)
+			switch {
+			case t.cfg.MaxRequests > 0 && n >= int64(t.cfg.MaxRequests):
+				t.recycle(w, "max_requests")
+			case t.cfg.MaxAge > 0 && t.now().Sub(ci.opened) >= t.cfg.MaxAge:
+				t.recycle(w, "max_age")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *ConnTracker) recycle(w http.ResponseWriter, reason string) {
+	w.Header().Set("Connection", "close")
+	t.recycled.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTrackedServer starts a test server instrumented by ct.
+func newTrackedServer(t *testing.T, ct *ConnTracker) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(ct.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})))
+	srv.Config.ConnState = ct.ConnState
+	srv.Config.ConnContext = ct.ConnContext
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp
+}
+
+func TestConnTracker_RecyclesAfterMaxRequests(t *testing.T) {
+	ct := NewConnTracker(ConnConfig{MaxRequests: 2}, prometheus.NewRegistry())
+	srv := newTrackedServer(t, ct)
+	client := srv.Client()
+
+	if resp := get(t, client, srv.URL); resp.Close {
+		t.Error("expected the first response to keep the connection alive")
+	}
+	if resp := get(t, client, srv.URL); !resp.Close {
+		t.Error("expected Connection: close on the second response")
+	}
+	get(t, client, srv.URL)
+
+	if got := testutil.ToFloat64(ct.opened); got != 2 {
+		t.Errorf("expected 2 connections for 3 requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(ct.recycled.WithLabelValues("max_requests")); got != 1 {
+		t.Errorf("expected 1 recycled connection, got %v", got)
+	}
+}
+
+func TestConnTracker_RecyclesAfterMaxAge(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	ct := NewConnTracker(ConnConfig{MaxAge: time.Minute}, prometheus.NewRegistry())
+	ct.now = clock.Now
+	srv := newTrackedServer(t, ct)
+	client := srv.Client()
+
+	if resp := get(t, client, srv.URL); resp.Close {
+		t.Error("expected a young connection to be kept alive")
+	}
+	clock.Advance(time.Minute)
+	if resp := get(t, client, srv.URL); !resp.Close {
+		t.Error("expected Connection: close once the connection is MaxAge old")
+	}
+	if got := testutil.ToFloat64(ct.recycled.WithLabelValues("max_age")); got != 1 {
+		t.Errorf("expected 1 recycled connection, got %v", got)
+	}
+}
+
+func TestConnTracker_ConnStateMetrics(t *testing.T) {
+	ct := NewConnTracker(ConnConfig{}, prometheus.NewRegistry())
+	srv := newTrackedServer(t, ct)
+	client := srv.Client()
+
+	get(t, client, srv.URL)
+
+	// The keep-alive connection goes idle once the response is written.
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(ct.current.WithLabelValues("idle")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection never became idle")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(ct.current.WithLabelValues("active")); got != 0 {
+		t.Errorf("expected no active connections, got %v", got)
+	}
+
+	srv.CloseClientConnections()
+	deadline = time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(ct.closed) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection close was not recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(ct.current.WithLabelValues("idle")); got != 0 {
+		t.Errorf("expected no idle connections after close, got %v", got)
+	}
+}
+
+func TestConnTracker_NoLimitsPassesThrough(t *testing.T) {
+	ct := NewConnTracker(ConnConfig{}, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	ct.Middleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("Connection"); got != "" {
+		t.Errorf("expected no Connection header, got %q", got)
+	}
+}
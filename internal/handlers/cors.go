@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins lists origins permitted to make cross-origin requests.
+	// Entries are exact origins ("https://dash.example.com"), a single "*"
+	// for any origin, or contain one wildcard ("https://*.example.com").
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are advertised in preflight
+	// responses. An AllowedHeaders entry of "*" permits any request header.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials permits cookies and Authorization headers on
+	// cross-origin requests.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// CORS returns middleware that applies cfg to cross-origin requests. It must
+// run before routing so that preflight OPTIONS requests are answered for every
+// route without each one registering an OPTIONS handler. Preflights from
+// disallowed origins, or asking for disallowed methods or headers, get 403.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if !cfg.allowsOrigin(origin) {
+				if preflight {
+					writeError(w, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if preflight {
+				if !containsFold(cfg.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) ||
+					!cfg.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+					writeError(w, http.StatusForbidden, "cross-origin request not allowed")
+					return
+				}
+			}
+
+			// A literal "*" cannot be combined with credentials, so echo the
+			// origin whenever credentials are allowed.
+			if containsFold(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, pattern := range c.AllowedOrigins {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(pattern, "*")
+		if ok && len(origin) > len(prefix)+len(suffix) &&
+			hasPrefixFold(origin, prefix) && hasSuffixFold(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) allowsHeaders(requested string) bool {
+	if containsFold(c.AllowedHeaders, "*") {
+		return true
+	}
+	for name := range strings.SplitSeq(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !containsFold(c.AllowedHeaders, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
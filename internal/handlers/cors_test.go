@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"https://dash.example.com", "https://*.internal.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func serveCORS(cfg CORSConfig, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, called
+}
+
+func preflightRequest(origin, method, headers string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, "/info", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return req
+}
+
+func TestCORS_NoOriginPassesThrough(t *testing.T) {
+	rec, called := serveCORS(testCORSConfig(), httptest.NewRequest(http.MethodGet, "/info", nil))
+
+	if !called {
+		t.Error("expected handler to be called")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin, got %q", got)
+	}
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	for _, origin := range []string{"https://dash.example.com", "https://ci.internal.example.com"} {
+		t.Run(origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/info", nil)
+			req.Header.Set("Origin", origin)
+
+			rec, called := serveCORS(testCORSConfig(), req)
+
+			if !called {
+				t.Error("expected handler to be called")
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", origin, got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("expected Vary %q, got %q", "Origin", got)
+			}
+		})
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	for _, origin := range []string{"https://evil.example.org", "https://.internal.example.com", "http://dash.example.com"} {
+		t.Run(origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/info", nil)
+			req.Header.Set("Origin", origin)
+
+			rec, called := serveCORS(testCORSConfig(), req)
+
+			if !called {
+				t.Error("expected handler to be called for simple request")
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("expected no Access-Control-Allow-Origin, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	rec, called := serveCORS(testCORSConfig(), preflightRequest("https://dash.example.com", "POST", "content-type, authorization"))
+
+	if called {
+		t.Error("expected preflight to be answered by the middleware")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://dash.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Access-Control-Max-Age":       "600",
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("expected %s %q, got %q", k, v, got)
+		}
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("expected no Access-Control-Allow-Credentials, got %q", got)
+	}
+}
+
+func TestCORS_PreflightRejected(t *testing.T) {
+	tests := map[string]*http.Request{
+		"origin":  preflightRequest("https://evil.example.org", "GET", ""),
+		"method":  preflightRequest("https://dash.example.com", "DELETE", ""),
+		"headers": preflightRequest("https://dash.example.com", "GET", "X-Custom"),
+	}
+
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec, called := serveCORS(testCORSConfig(), req)
+
+			if called {
+				t.Error("expected handler not to be called")
+			}
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCORS_WildcardOrigin(t *testing.T) {
+	cfg := testCORSConfig()
+	cfg.AllowedOrigins = []string{"*"}
+	cfg.AllowedHeaders = []string{"*"}
+
+	rec, _ := serveCORS(cfg, preflightRequest("https://anything.example.net", "GET", "X-Custom"))
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected Access-Control-Allow-Origin %q, got %q", "*", got)
+	}
+}
+
+func TestCORS_CredentialsEchoOrigin(t *testing.T) {
+	cfg := testCORSConfig()
+	cfg.AllowCredentials = true
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	rec, _ := serveCORS(cfg, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("expected origin to be echoed, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expected Access-Control-Allow-Credentials %q, got %q", "true", got)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+	"github.com/mstephenholl/gitops-demo/internal/flags"
+)
+
+// FeatureFlags returns middleware that stores a flags.Evaluator for the
+// caller in the request context. Callers are bucketed by principal ID, or
+// by client IP when anonymous, so each keeps the same rollout and variants
+// across requests. It must run after Authenticate and RealIP.
+func FeatureFlags(set *flags.Set) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e := set.For(callerID(r))
+			next.ServeHTTP(w, r.WithContext(flags.NewContext(r.Context(), e)))
+		})
+	}
+}
+
+// callerID identifies the caller: the principal ID, or the client IP for
+// anonymous requests.
+func callerID(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return p.ID
+	}
+	return ClientIP(r)
+}
+
+// FlagResponse is the JSON form of a feature flag.
+type FlagResponse struct {
+	Name   string     `json:"name"`
+	Kind   flags.Kind `json:"kind"`
+	Value  string     `json:"value"`
+	Source string     `json:"source"`
+	// Configured is the definition beneath a runtime override.
+	Configured *FlagValue `json:"configured,omitempty"`
+}
+
+// FlagValue is a flag's value and where it came from.
+type FlagValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// FlagRequest is the JSON body of a flag override.
+type FlagRequest struct {
+	Value string `json:"value"`
+}
+
+func newFlagResponse(f flags.Flag) FlagResponse {
+	return FlagResponse{Name: f.Name, Kind: f.Kind, Value: f.Value(), Source: f.Source}
+}
+
+// ListFlags returns a handler that lists the feature flags in effect.
+func ListFlags(set *flags.Set) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out := []FlagResponse{}
+		for _, st := range set.List() {
+			resp := newFlagResponse(st.Flag)
+			if st.Configured != nil {
+				resp.Configured = &FlagValue{Value: st.Configured.Value(), Source: st.Configured.Source}
+			}
+			out = append(out, resp)
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// OverrideFlag returns a handler that overrides the flag named by the
+// {name} path parameter with the value in a FlagRequest body. It responds
+// 404 for undefined flags and 400 for invalid values.
+func OverrideFlag(set *flags.Set) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req FlagRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		f, err := set.Override(r.PathValue("name"), req.Value, callerID(r))
+		if err != nil {
+			writeFlagError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newFlagResponse(f))
+	}
+}
+
+// ClearFlagOverride returns a handler that removes the runtime override of
+// the flag named by the {name} path parameter, responding with the
+// configured flag now in effect.
+func ClearFlagOverride(set *flags.Set) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := set.ClearOverride(r.PathValue("name"), callerID(r))
+		if err != nil {
+			writeFlagError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newFlagResponse(f))
+	}
+}
+
+func writeFlagError(w http.ResponseWriter, err error) {
+	if errors.Is(err, flags.ErrUnknownFlag) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mstephenholl/gitops-demo/internal/auth"
+	"github.com/mstephenholl/gitops-demo/internal/flags"
+)
+
+func newTestFlagSet(t *testing.T, spec string) *flags.Set {
+	t.Helper()
+	defs, err := flags.Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range defs {
+		defs[i].Source = "env"
+	}
+	return flags.NewSet(discardLogger(), defs)
+}
+
+// flagsMux routes the flag handlers as the server does.
+func flagsMux(set *flags.Set) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /flags", ListFlags(set))
+	mux.Handle("PUT /flags/{name}", OverrideFlag(set))
+	mux.Handle("DELETE /flags/{name}", ClearFlagOverride(set))
+	return mux
+}
+
+func TestFeatureFlags_BucketsByCaller(t *testing.T) {
+	set := newTestFlagSet(t, "theme=a|b|c|d|e|f|g|h")
+
+	var got []string
+	h := FeatureFlags(set)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, flags.FromContext(r.Context()).Variant("theme"))
+	}))
+
+	serve := func(id, remote string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		if id != "" {
+			req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{ID: id}))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("alice", "192.0.2.1:1234")
+	serve("alice", "192.0.2.2:1234")
+	if got[0] != got[1] || got[0] == "" {
+		t.Errorf("expected a principal to keep its variant across addresses, got %q", got)
+	}
+
+	serve("", "192.0.2.1:1234")
+	serve("", "192.0.2.1:5678")
+	if got[2] != got[3] || got[2] != set.For("192.0.2.1").Variant("theme") {
+		t.Errorf("expected anonymous callers to be bucketed by client IP, got %q", got[2:])
+	}
+}
+
+func TestFlagHandlers(t *testing.T) {
+	set := newTestFlagSet(t, "dark-mode=false,new-checkout=10%")
+	mux := flagsMux(set)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPut, "/flags/new-checkout", `{"value":"50%"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"source":"override"`) {
+		t.Fatalf("expected the override to be applied, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/flags", "")
+	var list []FlagResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "dark-mode" || list[0].Configured != nil {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	if nc := list[1]; nc.Value != "50%" || nc.Configured == nil || nc.Configured.Value != "10%" || nc.Configured.Source != "env" {
+		t.Errorf("expected the override over the configured value, got %+v", nc)
+	}
+
+	rec = do(http.MethodDelete, "/flags/new-checkout", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":"10%"`) {
+		t.Errorf("expected the configured flag back, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFlagHandlers_Errors(t *testing.T) {
+	mux := flagsMux(newTestFlagSet(t, "dark-mode=false"))
+
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+	}{
+		{http.MethodPut, "/flags/missing", `{"value":"true"}`, http.StatusNotFound},
+		{http.MethodPut, "/flags/missing", `{"value":"bogus"}`, http.StatusNotFound},
+		{http.MethodPut, "/flags/dark-mode", `{"value":"bogus"}`, http.StatusBadRequest},
+		{http.MethodPut, "/flags/dark-mode", `{"enabled":true}`, http.StatusBadRequest},
+		{http.MethodDelete, "/flags/missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.path, tt.body, tt.wantStatus, rec.Code)
+		}
+	}
+}
@@ -5,13 +5,22 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/mstephenholl/gitops-demo/internal/instance"
 	"github.com/mstephenholl/gitops-demo/internal/version"
 )
 
 // HealthResponse is the JSON body returned by the health and readiness probes.
 type HealthResponse struct {
 	Status string `json:"status"`
+	// Reason explains a failing probe.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ErrorResponse is the JSON body returned for all error responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
 }
 
 // Healthz returns an HTTP 200 with status "ok". Used as a liveness probe.
@@ -22,18 +31,58 @@ func Healthz(logger *slog.Logger) http.HandlerFunc {
 	}
 }
 
-// Readyz returns an HTTP 200 with status "ready". Used as a readiness probe.
-func Readyz(logger *slog.Logger) http.HandlerFunc {
+// Readyz returns an HTTP 200 with status "ready" while lc is ready, and a
+// 503 with status "not ready" and the reason otherwise. A nil lc is always
+// ready. Used as a readiness probe.
+func Readyz(logger *slog.Logger, lc *Lifecycle) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("readiness probe hit")
+		if lc != nil {
+			if rd := lc.Readiness(); !rd.Ready {
+				writeJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "not ready", Reason: rd.Reason})
+				return
+			}
+		}
 		writeJSON(w, http.StatusOK, HealthResponse{Status: "ready"})
 	}
 }
 
-// Info returns build metadata injected at compile time.
-func Info(logger *slog.Logger) http.HandlerFunc {
+// ServerInfo is the JSON body returned by Info: the build metadata plus
+// facts about the running process that let tooling compare replicas.
+type ServerInfo struct {
+	version.Info
+
+	// Environment is the deployment environment, such as prod.
+	Environment string `json:"environment,omitempty"`
+	// ConfigHash fingerprints the non-secret effective configuration.
+	// Replicas with the same hash run with the same settings.
+	ConfigHash string `json:"config_hash,omitempty"`
+	// LastReload is when a config reload last changed settings.
+	LastReload time.Time `json:"last_reload,omitzero"`
+
+	StartTime time.Time `json:"start_time,omitzero"`
+	// Uptime is the time since StartTime, to the second.
+	Uptime    string         `json:"uptime,omitempty"`
+	State     LifecycleState `json:"state,omitempty"`
+	Readiness *Readiness     `json:"readiness,omitempty"`
+	// Maintenance reports whether maintenance mode is turning requests
+	// away.
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty"`
+
+	// Instance identifies the pod serving the request.
+	Instance instance.Info `json:"instance,omitzero"`
+}
+
+// Info returns build metadata injected at compile time, together with the
+// process details from describe, which is called on every request and may
+// be nil.
+func Info(logger *slog.Logger, describe func() ServerInfo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		info := version.Get()
+		var info ServerInfo
+		if describe != nil {
+			info = describe()
+		}
+		info.Info = version.Get()
 		logger.Info("info endpoint hit",
 			slog.String("tag", info.Tag),
 			slog.String("commit", info.Commit),
@@ -50,3 +99,8 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
 	}
 }
+
+// writeError writes an ErrorResponse with the given status code and message.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
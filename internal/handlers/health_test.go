@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mstephenholl/gitops-demo/internal/version"
 )
@@ -60,7 +61,7 @@ func TestHealthz_ContentType(t *testing.T) {
 }
 
 func TestReadyz_ReturnsReady(t *testing.T) {
-	handler := Readyz(discardLogger())
+	handler := Readyz(discardLogger(), nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	rec := httptest.NewRecorder()
@@ -81,6 +82,32 @@ func TestReadyz_ReturnsReady(t *testing.T) {
 	}
 }
 
+func TestReadyz_FollowsLifecycle(t *testing.T) {
+	lc := NewLifecycle(time.Now())
+	handler := Readyz(discardLogger(), lc)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d while starting, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	var resp HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "not ready" || resp.Reason != "starting" {
+		t.Errorf("expected not ready because starting, got %+v", resp)
+	}
+
+	lc.Set(StateReady)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d once ready, got %d", http.StatusOK, rec.Code)
+	}
+}
+
 func TestInfo_ReturnsBuildMetadata(t *testing.T) {
 	// Save and restore originals
 	origTag, origCommit, origBuildTime := version.Tag, version.Commit, version.BuildTime
@@ -92,7 +119,7 @@ func TestInfo_ReturnsBuildMetadata(t *testing.T) {
 	version.Commit = "deadbeef"
 	version.BuildTime = "2026-01-01T00:00:00Z"
 
-	handler := Info(discardLogger())
+	handler := Info(discardLogger(), nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/info", nil)
 	rec := httptest.NewRecorder()
@@ -122,8 +149,29 @@ func TestInfo_ReturnsBuildMetadata(t *testing.T) {
 	}
 }
 
+func TestInfo_IncludesServerDetails(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	handler := Info(discardLogger(), func() ServerInfo {
+		return ServerInfo{Environment: "staging", ConfigHash: "abc123", StartTime: started}
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+
+	var info ServerInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if info.Environment != "staging" || info.ConfigHash != "abc123" || !info.StartTime.Equal(started) {
+		t.Errorf("unexpected server details: %+v", info)
+	}
+	if info.Tag != version.Tag {
+		t.Errorf("expected build metadata alongside, got tag %q", info.Tag)
+	}
+}
+
 func TestInfo_ContentType(t *testing.T) {
-	handler := Info(discardLogger())
+	handler := Info(discardLogger(), nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/info", nil)
 	rec := httptest.NewRecorder()
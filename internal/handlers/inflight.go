@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ActiveRequest describes a request that is still being served.
+type ActiveRequest struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Route is the matched route pattern, such as /flags/{name}, once
+	// routing has found one.
+	Route    string    `json:"route,omitempty"`
+	ClientIP string    `json:"client_ip"`
+	Started  time.Time `json:"started"`
+	// Age is how long the request has been running, to the millisecond.
+	Age string `json:"age"`
+}
+
+// LogValue logs the request without its start time, which Age implies.
+func (a ActiveRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", a.ID),
+		slog.String("method", a.Method),
+		slog.String("path", a.Path),
+		slog.String("route", a.Route),
+		slog.String("client_ip", a.ClientIP),
+		slog.String("age", a.Age),
+	)
+}
+
+// InFlight is a registry of the requests being served, for finding slow or
+// stuck requests while the server runs and at shutdown. It is safe for
+// concurrent use.
+type InFlight struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	active map[*inflightEntry]struct{}
+}
+
+type inflightEntry struct {
+	reg *InFlight
+	req ActiveRequest
+}
+
+type inflightKey struct{}
+
+// NewInFlight returns an empty registry.
+func NewInFlight() *InFlight {
+	return &InFlight{now: time.Now, active: map[*inflightEntry]struct{}{}}
+}
+
+// Middleware registers each request for as long as it is served. It must
+// run after RealIP and RequestID.
+func (f *InFlight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &inflightEntry{reg: f, req: ActiveRequest{
+			ID:       RequestIDFromContext(r.Context()),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			ClientIP: ClientIP(r),
+			Started:  f.now(),
+		}}
+
+		f.mu.Lock()
+		f.active[e] = struct{}{}
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			delete(f.active, e)
+			f.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), inflightKey{}, e)))
+	})
+}
+
+// SetRoute records the route pattern matched for the request carrying ctx.
+// It is a no-op outside Middleware.
+func SetRoute(ctx context.Context, route string) {
+	e, ok := ctx.Value(inflightKey{}).(*inflightEntry)
+	if !ok {
+		return
+	}
+	e.reg.mu.Lock()
+	defer e.reg.mu.Unlock()
+	e.req.Route = route
+}
+
+// List returns the active requests, oldest first.
+func (f *InFlight) List() []ActiveRequest {
+	now := f.now()
+
+	f.mu.Lock()
+	out := make([]ActiveRequest, 0, len(f.active))
+	for e := range f.active {
+		out = append(out, e.req)
+	}
+	f.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b ActiveRequest) int { return a.Started.Compare(b.Started) })
+	for i := range out {
+		out[i].Age = now.Sub(out[i].Started).Truncate(time.Millisecond).String()
+	}
+	return out
+}
+
+// ActiveRequests returns a handler that lists the requests being served,
+// oldest first.
+func ActiveRequests(f *InFlight) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, f.List())
+	}
+}
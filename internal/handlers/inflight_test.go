@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInFlight_TracksActiveRequests(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	f := NewInFlight()
+	f.now = clock.Now
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	h := RequestID(f.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			SetRoute(r.Context(), "/slow")
+			entered <- struct{}{}
+			<-release
+		}
+	})))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/slow", nil)
+		req.Header.Set(RequestIDHeader, "req-1")
+		req.RemoteAddr = "192.0.2.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-entered
+	clock.Advance(1500 * time.Millisecond)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+
+	active := f.List()
+	if len(active) != 1 {
+		t.Fatalf("expected one active request, got %+v", active)
+	}
+	want := ActiveRequest{ID: "req-1", Method: http.MethodPost, Path: "/slow", Route: "/slow", ClientIP: "192.0.2.1", Started: time.Unix(1000, 0), Age: "1.5s"}
+	if got := active[0]; got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	close(release)
+	<-done
+	if active := f.List(); len(active) != 0 {
+		t.Errorf("expected no active requests once served, got %+v", active)
+	}
+}
+
+func TestInFlight_ListOldestFirst(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	f := NewInFlight()
+	f.now = clock.Now
+
+	var paths []string
+	list := ActiveRequests(f)
+	h := f.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(time.Second)
+		if r.URL.Path == "/outer" {
+			f.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rec := httptest.NewRecorder()
+				list(rec, r)
+				var active []ActiveRequest
+				if err := json.NewDecoder(rec.Body).Decode(&active); err != nil {
+					t.Errorf("failed to decode list: %v", err)
+				}
+				for _, a := range active {
+					paths = append(paths, a.Path+" "+a.Age)
+				}
+			})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/inner", nil))
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/outer", nil))
+
+	if got := strings.Join(paths, ", "); got != "/outer 1s, /inner 0s" {
+		t.Errorf("expected the oldest request first, got %q", got)
+	}
+}
+
+func TestSetRoute_OutsideMiddleware(t *testing.T) {
+	SetRoute(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "/") // must not panic
+}
+
+func TestActiveRequest_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("active",
+		slog.Any("request", ActiveRequest{ID: "r1", Method: "GET", Path: "/x", Route: "/x", ClientIP: "192.0.2.1", Age: "2s"}))
+
+	out := buf.String()
+	for _, want := range []string{"request.id=r1", "request.route=/x", "request.client_ip=192.0.2.1", "request.age=2s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %s", want, out)
+		}
+	}
+}
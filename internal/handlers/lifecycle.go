@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LifecycleState is the phase of the server process.
+type LifecycleState string
+
+// The server moves through the states in order.
+const (
+	// StateStarting is set until the listeners are open.
+	StateStarting LifecycleState = "starting"
+	// StateReady serves traffic and passes the readiness probe.
+	StateReady LifecycleState = "ready"
+	// StateDraining still serves traffic but fails the readiness probe so
+	// that the pod leaves the Service endpoints before it stops.
+	StateDraining LifecycleState = "draining"
+	// StateStopping has closed the listeners and is finishing in-flight
+	// requests.
+	StateStopping LifecycleState = "stopping"
+)
+
+// Readiness summarises whether the instance should receive traffic.
+type Readiness struct {
+	Ready bool `json:"ready"`
+	// Reason explains why the instance is not ready.
+	Reason string `json:"reason,omitempty"`
+	// Override is set while an operator holds the instance out of
+	// rotation.
+	Override *ReadinessOverride `json:"override,omitempty"`
+}
+
+// ReadinessOverride takes a ready instance out of rotation by hand, for
+// example to debug it live without traffic.
+type ReadinessOverride struct {
+	Reason string    `json:"reason"`
+	By     string    `json:"by"`
+	Since  time.Time `json:"since"`
+	// Until is when the override lapses by itself. Zero never does.
+	Until time.Time `json:"until,omitzero"`
+}
+
+// expired reports whether the override has lapsed at now.
+func (o ReadinessOverride) expired(now time.Time) bool {
+	return !o.Until.IsZero() && !now.Before(o.Until)
+}
+
+// Lifecycle tracks the state of the server process for the readiness probe
+// and /info. It is safe for concurrent use.
+type Lifecycle struct {
+	started time.Time
+	now     func() time.Time
+
+	mu       sync.RWMutex
+	state    LifecycleState
+	since    time.Time
+	override *ReadinessOverride
+}
+
+// NewLifecycle returns a Lifecycle in StateStarting for a process that
+// started at started.
+func NewLifecycle(started time.Time) *Lifecycle {
+	return &Lifecycle{
+		started: started,
+		now:     time.Now,
+		state:   StateStarting,
+		since:   started,
+	}
+}
+
+// Set moves the lifecycle to state.
+func (l *Lifecycle) Set(state LifecycleState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state, l.since = state, l.now()
+}
+
+// State returns the current state and when it was entered.
+func (l *Lifecycle) State() (LifecycleState, time.Time) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.state, l.since
+}
+
+// Started returns when the process started.
+func (l *Lifecycle) Started() time.Time {
+	return l.started
+}
+
+// Uptime returns how long the process has been running.
+func (l *Lifecycle) Uptime() time.Duration {
+	return l.now().Sub(l.started)
+}
+
+// Override takes the instance out of rotation for reason until it is
+// cleared or, when ttl is positive, ttl has passed. by names who asked.
+func (l *Lifecycle) Override(reason, by string, ttl time.Duration) ReadinessOverride {
+	now := l.now()
+	o := ReadinessOverride{Reason: reason, By: by, Since: now}
+	if ttl > 0 {
+		o.Until = now.Add(ttl)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.override = &o
+	return o
+}
+
+// ClearOverride puts the instance back in rotation, reporting whether an
+// override was in effect.
+func (l *Lifecycle) ClearOverride() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	active := l.override != nil && !l.override.expired(l.now())
+	l.override = nil
+	return active
+}
+
+// Readiness reports whether the instance should receive traffic: only in
+// StateReady, and not while an override is in effect.
+func (l *Lifecycle) Readiness() Readiness {
+	l.mu.RLock()
+	state, o := l.state, l.override
+	l.mu.RUnlock()
+
+	if state != StateReady {
+		return Readiness{Reason: string(state)}
+	}
+	if o != nil && !o.expired(l.now()) {
+		o := *o
+		return Readiness{Reason: "override: " + o.Reason, Override: &o}
+	}
+	return Readiness{Ready: true}
+}
+
+// ReadinessOverrideRequest is the JSON body that takes the instance out of
+// rotation.
+type ReadinessOverrideRequest struct {
+	Reason string `json:"reason"`
+	// ExpiresIn is how long the override lasts, such as "30m". Empty
+	// lasts until it is cleared.
+	ExpiresIn string `json:"expires_in"`
+}
+
+// OverrideReadiness returns a handler that makes the readiness probe fail
+// with the reason in a ReadinessOverrideRequest, so that the instance
+// leaves the Service endpoints while it keeps running and passing its
+// liveness probe.
+func OverrideReadiness(logger *slog.Logger, lc *Lifecycle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ReadinessOverrideRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if req.Reason == "" {
+			writeError(w, http.StatusBadRequest, "reason is required")
+			return
+		}
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("expires_in %q must be a positive duration", req.ExpiresIn))
+				return
+			}
+			ttl = d
+		}
+
+		o := lc.Override(req.Reason, callerID(r), ttl)
+		attrs := []slog.Attr{slog.String("by", o.By), slog.String("reason", o.Reason)}
+		if !o.Until.IsZero() {
+			attrs = append(attrs, slog.Time("until", o.Until))
+		}
+		logger.LogAttrs(r.Context(), slog.LevelWarn, "readiness overridden, out of rotation", attrs...)
+		writeJSON(w, http.StatusOK, o)
+	}
+}
+
+// ClearReadinessOverride returns a handler that removes the readiness
+// override and responds with the readiness now in effect.
+func ClearReadinessOverride(logger *slog.Logger, lc *Lifecycle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if lc.ClearOverride() {
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "readiness override cleared", slog.String("by", callerID(r)))
+		}
+		writeJSON(w, http.StatusOK, lc.Readiness())
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycle_States(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	lc := NewLifecycle(clock.Now())
+	lc.now = clock.Now
+
+	if state, since := lc.State(); state != StateStarting || !since.Equal(clock.Now()) {
+		t.Errorf("expected starting since process start, got %s since %v", state, since)
+	}
+	if rd := lc.Readiness(); rd.Ready || rd.Reason != "starting" {
+		t.Errorf("expected not ready while starting, got %+v", rd)
+	}
+
+	clock.Advance(2 * time.Second)
+	lc.Set(StateReady)
+	if rd := lc.Readiness(); !rd.Ready || rd.Reason != "" {
+		t.Errorf("expected ready, got %+v", rd)
+	}
+
+	clock.Advance(time.Minute)
+	lc.Set(StateDraining)
+	if state, since := lc.State(); state != StateDraining || !since.Equal(clock.Now()) {
+		t.Errorf("expected draining since now, got %s since %v", state, since)
+	}
+	if rd := lc.Readiness(); rd.Ready || rd.Reason != "draining" {
+		t.Errorf("expected not ready while draining, got %+v", rd)
+	}
+	if got := lc.Uptime(); got != 62*time.Second {
+		t.Errorf("expected uptime 62s, got %v", got)
+	}
+	if !lc.Started().Equal(time.Unix(1000, 0)) {
+		t.Errorf("unexpected start time %v", lc.Started())
+	}
+}
+
+func TestLifecycle_Override(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	lc := NewLifecycle(clock.Now())
+	lc.now = clock.Now
+	lc.Set(StateReady)
+
+	o := lc.Override("debugging", "ops", time.Minute)
+	if !o.Until.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("expected the override to lapse in a minute, got %v", o.Until)
+	}
+	rd := lc.Readiness()
+	if rd.Ready || rd.Reason != "override: debugging" || rd.Override == nil || rd.Override.By != "ops" {
+		t.Errorf("expected not ready under the override, got %+v", rd)
+	}
+
+	clock.Advance(time.Minute)
+	if rd := lc.Readiness(); !rd.Ready || rd.Override != nil {
+		t.Errorf("expected ready once the override lapsed, got %+v", rd)
+	}
+	if lc.ClearOverride() {
+		t.Error("expected a lapsed override not to count as active")
+	}
+
+	lc.Override("debugging", "ops", 0)
+	clock.Advance(24 * time.Hour)
+	if rd := lc.Readiness(); rd.Ready {
+		t.Error("expected an override without expiry to hold")
+	}
+	lc.Set(StateDraining)
+	if rd := lc.Readiness(); rd.Reason != "draining" {
+		t.Errorf("expected the lifecycle state to take precedence, got %+v", rd)
+	}
+	lc.Set(StateReady)
+	if !lc.ClearOverride() || !lc.Readiness().Ready {
+		t.Error("expected ready after clearing the override")
+	}
+}
+
+func TestReadinessOverrideHandlers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	lc := NewLifecycle(time.Now())
+	lc.Set(StateReady)
+
+	for body, want := range map[string]int{
+		`{}`:                                 http.StatusBadRequest,
+		`{"reason":"x","expires_in":"soon"}`: http.StatusBadRequest,
+		`{"reason":"x","expires_in":"-1m"}`:  http.StatusBadRequest,
+		`{"reason":"x","ttl":"1m"}`:          http.StatusBadRequest,
+		`{"reason":"x","expires_in":"30m"}`:  http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		OverrideReadiness(logger, lc)(rec, httptest.NewRequest(http.MethodPut, "/readiness", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%s: expected status %d, got %d", body, want, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Readyz(discardLogger(), lc)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"reason":"override: x"`) {
+		t.Errorf("expected readyz to fail with the override reason, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	Healthz(discardLogger())(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected healthz to stay healthy, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ClearReadinessOverride(logger, lc)(rec, httptest.NewRequest(http.MethodDelete, "/readiness", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ready":true`) {
+		t.Errorf("expected ready after clearing, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	out := buf.String()
+	for _, want := range []string{"readiness overridden, out of rotation", "reason=x until=", "readiness override cleared"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaintenanceConfig controls the response served in maintenance mode.
+type MaintenanceConfig struct {
+	// Message is the error returned to clients, unless the switch that
+	// enabled maintenance gave its own.
+	Message string
+	// RetryAfter is sent as the Retry-After header, in whole seconds. Zero
+	// omits the header.
+	RetryAfter time.Duration
+	// Allowlist holds client addresses that are served as usual, such as
+	// the team running a migration.
+	Allowlist []netip.Prefix
+}
+
+// MaintenanceStatus describes whether maintenance mode is on.
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	// Since is when maintenance mode last changed.
+	Since time.Time `json:"since,omitzero"`
+	// By names who or what changed it: a principal, a signal or the file.
+	By      string `json:"by,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Maintenance is the maintenance mode switch. While it is on, Middleware
+// answers requests with 503 so that the service stays up, and its probes
+// pass, while it is unable to serve. Every change is logged. It is safe for
+// concurrent use.
+type Maintenance struct {
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	cfg     MaintenanceConfig
+	status  MaintenanceStatus
+	message string
+}
+
+// NewMaintenance returns a Maintenance switch that is off.
+func NewMaintenance(logger *slog.Logger, cfg MaintenanceConfig) *Maintenance {
+	return &Maintenance{logger: logger, now: time.Now, cfg: cfg}
+}
+
+// SetConfig replaces the message, Retry-After and allowlist, leaving the
+// switch as it is.
+func (m *Maintenance) SetConfig(cfg MaintenanceConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+}
+
+// Enable turns maintenance mode on, or updates its message if it is already
+// on. An empty message uses the configured one.
+func (m *Maintenance) Enable(message, by string) MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status.Enabled && m.message == message {
+		return m.statusLocked()
+	}
+	m.status = MaintenanceStatus{Enabled: true, Since: m.now(), By: by}
+	m.message = message
+	st := m.statusLocked()
+	m.logger.LogAttrs(context.Background(), slog.LevelWarn, "maintenance mode enabled",
+		slog.String("by", by),
+		slog.String("message", st.Message),
+	)
+	return st
+}
+
+// Disable turns maintenance mode off.
+func (m *Maintenance) Disable(by string) MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.status.Enabled {
+		return m.statusLocked()
+	}
+	now := m.now()
+	m.logger.LogAttrs(context.Background(), slog.LevelInfo, "maintenance mode disabled",
+		slog.String("by", by),
+		slog.Duration("duration", now.Sub(m.status.Since)),
+	)
+	m.status = MaintenanceStatus{Since: now, By: by}
+	m.message = ""
+	return m.statusLocked()
+}
+
+// Toggle turns maintenance mode on if it is off, and off if it is on.
+func (m *Maintenance) Toggle(by string) MaintenanceStatus {
+	if m.Status().Enabled {
+		return m.Disable(by)
+	}
+	return m.Enable("", by)
+}
+
+// Status returns the current state of maintenance mode.
+func (m *Maintenance) Status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.statusLocked()
+}
+
+// statusLocked returns the status with the message in effect. m.mu must be
+// held.
+func (m *Maintenance) statusLocked() MaintenanceStatus {
+	st := m.status
+	if st.Enabled {
+		st.Message = m.message
+		if st.Message == "" {
+			st.Message = m.cfg.Message
+		}
+	}
+	return st
+}
+
+// blocks reports whether maintenance mode turns r away, returning the
+// message and Retry-After to send.
+func (m *Maintenance) blocks(r *http.Request) (string, time.Duration, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.status.Enabled {
+		return "", 0, false
+	}
+	if addr, err := netip.ParseAddr(ClientIP(r)); err == nil {
+		addr = addr.Unmap()
+		for _, p := range m.cfg.Allowlist {
+			if p.Contains(addr) {
+				return "", 0, false
+			}
+		}
+	}
+	return m.statusLocked().Message, m.cfg.RetryAfter, true
+}
+
+// Middleware answers requests with 503, the maintenance message and
+// Retry-After while maintenance mode is on, except for clients in the
+// allowlist. It must run after RealIP.
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg, retryAfter, ok := m.blocks(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		AddLogAttrs(r.Context(), slog.Bool("maintenance", true))
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		writeError(w, http.StatusServiceUnavailable, msg)
+	})
+}
+
+// MaintenanceRequest is the optional JSON body that turns maintenance mode
+// on.
+type MaintenanceRequest struct {
+	// Message replaces the configured message until maintenance ends.
+	Message string `json:"message"`
+}
+
+// EnableMaintenance returns a handler that turns maintenance mode on, with
+// the message from an optional MaintenanceRequest body.
+func EnableMaintenance(m *Maintenance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MaintenanceRequest
+		if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+			return
+		}
+		writeJSON(w, http.StatusOK, m.Enable(req.Message, callerID(r)))
+	}
+}
+
+// DisableMaintenance returns a handler that turns maintenance mode off.
+func DisableMaintenance(m *Maintenance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Disable(callerID(r)))
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenance_Middleware(t *testing.T) {
+	m := NewMaintenance(discardLogger(), MaintenanceConfig{
+		Message:    "back soon",
+		RetryAfter: 90*time.Second + time.Millisecond,
+		Allowlist:  []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+	})
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/info", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("198.51.100.7:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected requests to pass while maintenance is off, got %d", rec.Code)
+	}
+
+	m.Enable("", "test")
+	rec := serve("198.51.100.7:1234")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 in maintenance mode, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "91" {
+		t.Errorf("expected Retry-After rounded up to 91, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), `"error":"back soon"`) {
+		t.Errorf("expected the configured message, got %s", rec.Body.String())
+	}
+	if rec := serve("[::ffff:192.0.2.10]:1234"); rec.Code != http.StatusOK {
+		t.Errorf("expected allowlisted clients to be served, got %d", rec.Code)
+	}
+
+	m.Enable("migrating orders", "test")
+	if rec := serve("198.51.100.7:1234"); !strings.Contains(rec.Body.String(), "migrating orders") {
+		t.Errorf("expected the message given when enabling, got %s", rec.Body.String())
+	}
+
+	m.SetConfig(MaintenanceConfig{Message: "back soon"})
+	if rec := serve("198.51.100.7:1234"); rec.Header().Get("Retry-After") != "" {
+		t.Errorf("expected no Retry-After when it is zero, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	m.Disable("test")
+	if rec := serve("198.51.100.7:1234"); rec.Code != http.StatusOK {
+		t.Errorf("expected requests to pass after maintenance, got %d", rec.Code)
+	}
+}
+
+func TestMaintenance_StatusAndLogging(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	m := NewMaintenance(slog.New(slog.NewTextHandler(&buf, nil)), MaintenanceConfig{Message: "down"})
+	m.now = clock.Now
+
+	if st := m.Toggle("SIGUSR1"); !st.Enabled || st.By != "SIGUSR1" || st.Message != "down" || !st.Since.Equal(clock.Now()) {
+		t.Errorf("unexpected status after enabling: %+v", st)
+	}
+	m.Enable("", "ops")
+	clock.Advance(2 * time.Minute)
+	if st := m.Toggle("ops"); st.Enabled || st.Message != "" {
+		t.Errorf("unexpected status after disabling: %+v", st)
+	}
+	m.Disable("ops")
+
+	out := buf.String()
+	if n := strings.Count(out, "maintenance mode enabled"); n != 1 {
+		t.Errorf("expected one enable to be logged, got %d:\n%s", n, out)
+	}
+	if n := strings.Count(out, "maintenance mode disabled"); n != 1 {
+		t.Errorf("expected one disable to be logged, got %d:\n%s", n, out)
+	}
+	for _, want := range []string{"by=SIGUSR1 message=down", "by=ops duration=2m0s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestMaintenanceHandlers(t *testing.T) {
+	m := NewMaintenance(discardLogger(), MaintenanceConfig{Message: "down"})
+
+	rec := httptest.NewRecorder()
+	EnableMaintenance(m)(rec, httptest.NewRequest(http.MethodPut, "/maintenance", strings.NewReader(`{"message":"migrating"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"message":"migrating"`) {
+		t.Errorf("expected maintenance on with the message, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	DisableMaintenance(m)(rec, httptest.NewRequest(http.MethodDelete, "/maintenance", nil))
+	if rec.Code != http.StatusOK || m.Status().Enabled {
+		t.Errorf("expected maintenance off, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	EnableMaintenance(m)(rec, httptest.NewRequest(http.MethodPut, "/maintenance", nil))
+	if rec.Code != http.StatusOK || m.Status().Message != "down" {
+		t.Errorf("expected maintenance on with the configured message, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	EnableMaintenance(m)(rec, httptest.NewRequest(http.MethodPut, "/maintenance", strings.NewReader(`{"reason":"x"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown field, got %d", rec.Code)
+	}
+}
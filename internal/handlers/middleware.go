@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 )
 
-// responseRecorder wraps http.ResponseWriter to capture the status code.
+// responseRecorder wraps http.ResponseWriter to capture the status code and
+// the number of body bytes written.
 type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 // WriteHeader captures the status code before delegating.
@@ -18,6 +23,40 @@ func (rr *responseRecorder) WriteHeader(code int) {
 	rr.ResponseWriter.WriteHeader(code)
 }
 
+// Write counts the body bytes before delegating.
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(p)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// logAttrsKey is the context key for the attributes collected by AddLogAttrs.
+type logAttrsKey struct{}
+
+// logAttrs collects extra attributes for a request's completion log entry.
+type logAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// AddLogAttrs attaches attributes to the "request completed" entry that
+// RequestLogger writes for the request carrying ctx. It is a no-op outside
+// RequestLogger.
+func AddLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	la, ok := ctx.Value(logAttrsKey{}).(*logAttrs)
+	if !ok {
+		return
+	}
+	la.mu.Lock()
+	defer la.mu.Unlock()
+	la.attrs = append(la.attrs, attrs...)
+}
+
 // RequestLogger returns middleware that logs every HTTP request with slog.
 func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -28,16 +67,85 @@ func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
 				ResponseWriter: w,
 				statusCode:     http.StatusOK,
 			}
+			extra := &logAttrs{}
 
-			next.ServeHTTP(rec, r)
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), logAttrsKey{}, extra)))
 
-			logger.Info("request completed",
+			attrs := []slog.Attr{
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.Int("status", rec.statusCode),
+				slog.Int("bytes", rec.bytes),
 				slog.Duration("duration", time.Since(start)),
 				slog.String("remote_addr", r.RemoteAddr),
-			)
+				slog.String("client_ip", ClientIP(r)),
+			}
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			extra.mu.Lock()
+			attrs = append(attrs, extra.attrs...)
+			extra.mu.Unlock()
+
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request completed", attrs...)
 		})
 	}
 }
+
+// ServedBy returns middleware that names the serving instance in an
+// X-Served-By header on every response. An empty name adds nothing.
+func ServedBy(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if name == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestID is middleware that gives every request an ID, stored in the
+// request context and echoed in the X-Request-Id response header. A valid
+// X-Request-Id from the client or a proxy is kept so that one ID follows the
+// request across services; otherwise a random one is generated.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts up to 128 letters, digits and -_.: so that a
+// client-supplied ID is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the ID RequestID gave the request carrying
+// ctx, or "" outside RequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -103,3 +103,81 @@ func TestResponseRecorder_WriteHeader(t *testing.T) {
 		t.Errorf("expected underlying recorder code %d, got %d", http.StatusCreated, rec.Code)
 	}
 }
+
+func TestRequestLogger_IncludesAddedAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	handler := RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddLogAttrs(r.Context(), slog.String("extra", "value"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !strings.Contains(buf.String(), "extra=value") {
+		t.Errorf("expected log to contain extra=value, got: %s", buf.String())
+	}
+}
+
+func TestAddLogAttrs_NoopWithoutRequestLogger(t *testing.T) {
+	// Must not panic when the context was not prepared by RequestLogger.
+	AddLogAttrs(httptest.NewRequest(http.MethodGet, "/", nil).Context(), slog.String("k", "v"))
+}
+
+func TestServedBy(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	ServedBy("gitops-demo/gitops-demo-7d9f-abcde")(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("X-Served-By"); got != "gitops-demo/gitops-demo-7d9f-abcde" {
+		t.Errorf("expected X-Served-By to name the instance, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	ServedBy("")(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if _, ok := rec.Header()["X-Served-By"]; ok {
+		t.Error("expected no X-Served-By header without a name")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	var seen string
+	h := RequestID(RequestLogger(slog.New(slog.NewTextHandler(&buf, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	})))
+
+	for incoming, keep := range map[string]bool{
+		"":                         false,
+		"abc-123_x.y:z":            true,
+		"has space":                false,
+		"<script>":                 false,
+		strings.Repeat("a", 129):   false,
+		"01J9Z7Q4W8N6M5K3H2G1F0E9": true,
+	} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if incoming != "" {
+			req.Header.Set(RequestIDHeader, incoming)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(RequestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("%q: expected the response header to match the context ID %q, got %q", incoming, seen, got)
+		}
+		if (got == incoming) != keep {
+			t.Errorf("%q: expected keep=%v, got ID %q", incoming, keep, got)
+		}
+		if !strings.Contains(buf.String(), "request_id="+got) {
+			t.Errorf("%q: expected the ID in the request log, got %s", incoming, buf.String())
+		}
+	}
+}
+
+func TestRequestIDFromContext_Empty(t *testing.T) {
+	if id := RequestIDFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Errorf("expected no ID outside RequestID, got %q", id)
+	}
+}
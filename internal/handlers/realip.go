@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientKey is the context key for the clientInfo stored by RealIP.
+type clientKey struct{}
+
+// clientInfo is the result of resolving a request's client address.
+type clientInfo struct {
+	ip string
+	// trustedPeer is set when the direct peer is a trusted proxy, so its
+	// forwarding headers may be believed.
+	trustedPeer bool
+}
+
+// RealIP returns middleware that resolves the real client IP for requests
+// arriving through a trusted proxy. The Forwarded, X-Forwarded-For and
+// X-Real-IP headers are consulted, in that order, only when the direct
+// peer falls within trusted; address chains are walked from the right,
+// skipping trusted hops, so a client cannot spoof its address by
+// prepending entries. Read the result with ClientIP.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := clientInfo{ip: remoteHost(r.RemoteAddr)}
+
+			if peer, err := netip.ParseAddr(info.ip); err == nil && isTrusted(peer) {
+				info.trustedPeer = true
+				if ip, ok := forwardedClient(r.Header, isTrusted); ok {
+					info.ip = ip.String()
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, info)))
+		})
+	}
+}
+
+// ClientIP returns the client IP resolved by RealIP, or the host part of
+// r.RemoteAddr when RealIP has not run.
+func ClientIP(r *http.Request) string {
+	if info, ok := r.Context().Value(clientKey{}).(clientInfo); ok {
+		return info.ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+// fromTrustedProxy reports whether RealIP found the direct peer to be a
+// trusted proxy.
+func fromTrustedProxy(r *http.Request) bool {
+	info, ok := r.Context().Value(clientKey{}).(clientInfo)
+	return ok && info.trustedPeer
+}
+
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// forwardedClient picks the client address from the forwarding headers.
+func forwardedClient(h http.Header, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		return rightmostUntrusted(forwardedFor(values), isTrusted)
+	}
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		var chain []string
+		for _, v := range values {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+		return rightmostUntrusted(chain, isTrusted)
+	}
+	if v := h.Get("X-Real-IP"); v != "" {
+		addr, err := parseNodeAddr(v)
+		return addr, err == nil
+	}
+	return netip.Addr{}, false
+}
+
+// forwardedFor extracts the "for" parameters of RFC 7239 Forwarded headers.
+func forwardedFor(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for elem := range strings.SplitSeq(v, ",") {
+			for pair := range strings.SplitSeq(elem, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					out = append(out, val)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// rightmostUntrusted walks chain from the nearest hop outwards and returns
+// the first address that is not a trusted proxy. If every hop is trusted
+// the furthest one is the client. An unparseable hop ends the walk, since
+// nothing beyond it can be attributed to a trusted proxy.
+func rightmostUntrusted(chain []string, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var last netip.Addr
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := parseNodeAddr(chain[i])
+		if err != nil {
+			break
+		}
+		last = addr
+		if !isTrusted(addr) {
+			return addr, true
+		}
+	}
+	return last, last.IsValid()
+}
+
+// parseNodeAddr parses an address as it appears in forwarding headers:
+// optionally quoted, bracketed for IPv6, and with an optional port.
+func parseNodeAddr(s string) (netip.Addr, error) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
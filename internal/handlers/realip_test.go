@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func resolveClientIP(trusted []netip.Prefix, remoteAddr string, headers map[string]string) string {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	var got string
+	RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.42.0.0/16"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.9"},
+		{"trusted peer without headers", "10.42.0.7:5000", nil, "10.42.0.7"},
+		{"x-forwarded-for", "10.42.0.7:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"x-forwarded-for skips trusted hops", "10.42.0.7:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1, 10.42.1.1"}, "198.51.100.1"},
+		{"x-forwarded-for spoofed prefix", "10.42.0.7:5000",
+			map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"x-forwarded-for all trusted", "10.42.0.7:5000",
+			map[string]string{"X-Forwarded-For": "10.42.3.3, 10.42.1.1"}, "10.42.3.3"},
+		{"x-forwarded-for garbage", "10.42.0.7:5000",
+			map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.42.0.7"},
+		{"x-real-ip", "10.42.0.7:5000",
+			map[string]string{"X-Real-IP": "198.51.100.2"}, "198.51.100.2"},
+		{"forwarded", "10.42.0.7:5000",
+			map[string]string{"Forwarded": `for=198.51.100.3;proto=https, for=10.42.1.1`}, "198.51.100.3"},
+		{"forwarded ipv6 with port", "[fd00::1]:5000",
+			map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded wins over x-forwarded-for", "10.42.0.7:5000",
+			map[string]string{"Forwarded": "for=198.51.100.3", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.3"},
+		{"ipv4-mapped peer", "[::ffff:10.42.0.7]:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveClientIP(trusted, tt.remoteAddr, tt.headers); got != tt.want {
+				t.Errorf("expected client IP %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIP_WithoutRealIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:5000"
+
+	if got := ClientIP(req); got != "203.0.113.9" {
+		t.Errorf("expected %q, got %q", "203.0.113.9", got)
+	}
+}
+
+func TestRequestLogger_LogsClientIP(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	handler := RealIP([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})(
+		RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), "client_ip=198.51.100.1") {
+		t.Errorf("expected log to contain client_ip=198.51.100.1, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecurityHeadersConfig configures the SecurityHeaders middleware. Empty
+// string fields leave the corresponding header unset.
+type SecurityHeadersConfig struct {
+	ContentTypeOptions    string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+	// CacheControl is applied only when the handler did not set its own.
+	CacheControl string
+
+	// HSTSMaxAge enables Strict-Transport-Security on HTTPS requests when
+	// positive. TrustForwardedProto treats X-Forwarded-Proto: https as HTTPS
+	// when the peer is a proxy trusted by RealIP, for deployments where TLS
+	// ends at the ingress.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	TrustForwardedProto   bool
+
+	// RemoveHeaders are stripped from every response, e.g. "Server" or
+	// "X-Powered-By" added by libraries or upstream handlers.
+	RemoveHeaders []string
+}
+
+// SecurityHeaders returns middleware that adds hardening headers to every
+// response. Handlers may override any of them by setting the header
+// themselves.
+func SecurityHeaders(cfg SecurityHeadersConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			setIfNotEmpty(h, "X-Content-Type-Options", cfg.ContentTypeOptions)
+			setIfNotEmpty(h, "Referrer-Policy", cfg.ReferrerPolicy)
+			setIfNotEmpty(h, "Content-Security-Policy", cfg.ContentSecurityPolicy)
+			if hsts != "" && cfg.isHTTPS(r) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+
+			next.ServeHTTP(&secureWriter{ResponseWriter: w, cfg: &cfg}, r)
+		})
+	}
+}
+
+func (c *SecurityHeadersConfig) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return c.TrustForwardedProto && fromTrustedProxy(r) &&
+		strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+func setIfNotEmpty(h http.Header, key, value string) {
+	if value != "" {
+		h.Set(key, value)
+	}
+}
+
+// secureWriter applies the header defaults that depend on what the handler
+// set, immediately before the headers are sent.
+type secureWriter struct {
+	http.ResponseWriter
+	cfg         *SecurityHeadersConfig
+	wroteHeader bool
+}
+
+func (sw *secureWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		h := sw.Header()
+		for _, name := range sw.cfg.RemoveHeaders {
+			h.Del(name)
+		}
+		if h.Get("Cache-Control") == "" {
+			setIfNotEmpty(h, "Cache-Control", sw.cfg.CacheControl)
+		}
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *secureWriter) Write(p []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *secureWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
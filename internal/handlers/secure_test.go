@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func testSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		ContentTypeOptions:    "nosniff",
+		ReferrerPolicy:        "no-referrer",
+		ContentSecurityPolicy: "default-src 'none'",
+		CacheControl:          "no-store",
+		HSTSMaxAge:            24 * time.Hour,
+		RemoveHeaders:         []string{"Server", "X-Powered-By"},
+	}
+}
+
+func serveSecure(cfg SecurityHeadersConfig, inner http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	SecurityHeaders(cfg)(inner).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSecurityHeaders_Defaults(t *testing.T) {
+	rec := serveSecure(testSecurityHeadersConfig(), func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+	}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": "default-src 'none'",
+		"Cache-Control":           "no-store",
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("expected %s %q, got %q", k, v, got)
+		}
+	}
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("expected no Strict-Transport-Security over plain HTTP, got %q", got)
+	}
+}
+
+func TestSecurityHeaders_HandlerOverridesCacheControl(t *testing.T) {
+	rec := serveSecure(testSecurityHeadersConfig(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("ok"))
+	}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("Cache-Control"); got != "max-age=60" {
+		t.Errorf("expected handler Cache-Control to win, got %q", got)
+	}
+}
+
+func TestSecurityHeaders_RemovesIdentifyingHeaders(t *testing.T) {
+	rec := serveSecure(testSecurityHeadersConfig(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "demo/1.0")
+		w.Header().Set("X-Powered-By", "Go")
+		w.WriteHeader(http.StatusNoContent)
+	}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for _, h := range []string{"Server", "X-Powered-By"} {
+		if got := rec.Header().Get(h); got != "" {
+			t.Errorf("expected %s to be removed, got %q", h, got)
+		}
+	}
+}
+
+func TestSecurityHeaders_HSTS(t *testing.T) {
+	tlsReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	tlsReq.TLS = &tls.ConnectionState{}
+
+	forwardedReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	forwardedReq.Header.Set("X-Forwarded-Proto", "https")
+
+	// Run the request through RealIP with its peer trusted.
+	var trustedReq *http.Request
+	RealIP([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trustedReq = r
+	})).ServeHTTP(httptest.NewRecorder(), forwardedReq)
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		trustProto bool
+		includeSub bool
+		wantHSTS   string
+	}{
+		{"tls", tlsReq, false, false, "max-age=86400"},
+		{"tls with subdomains", tlsReq, false, true, "max-age=86400; includeSubDomains"},
+		{"forwarded proto not trusted", trustedReq, false, false, ""},
+		{"forwarded proto from unknown peer", forwardedReq, true, false, ""},
+		{"forwarded proto from trusted proxy", trustedReq, true, false, "max-age=86400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testSecurityHeadersConfig()
+			cfg.TrustForwardedProto = tt.trustProto
+			cfg.HSTSIncludeSubdomains = tt.includeSub
+
+			rec := serveSecure(cfg, func(w http.ResponseWriter, r *http.Request) {}, tt.req)
+
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("expected Strict-Transport-Security %q, got %q", tt.wantHSTS, got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_EmptyDisables(t *testing.T) {
+	rec := serveSecure(SecurityHeadersConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for _, h := range []string{"X-Content-Type-Options", "Referrer-Policy", "Content-Security-Policy", "Cache-Control"} {
+		if got := rec.Header().Get(h); got != "" {
+			t.Errorf("expected %s to be unset, got %q", h, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout returns middleware that gives each request a context deadline of d.
+// The handler's response is buffered; if it has not finished when the deadline
+// passes, the client receives a 504 JSON error instead, anything the handler
+// writes afterwards is discarded, and the request is logged with timed_out=true.
+// Handlers should watch r.Context() to stop work once the deadline passes.
+// A zero d disables the timeout.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	if d <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return TimeoutFunc(func() time.Duration { return d })
+}
+
+// TimeoutFunc is like Timeout but calls timeout for every request, so the
+// deadline can change while the server is running.
+func TimeoutFunc(timeout func() time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeout()
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ctx: ctx, header: make(http.Header)}
+			done := make(chan struct{})
+			panicCh := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicCh <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				tw.mu.Lock()
+				tw.completed = !tw.expired()
+				tw.mu.Unlock()
+				close(done)
+			}()
+
+			select {
+			case p := <-panicCh:
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			if tw.completed {
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.buf.Bytes())
+				return
+			}
+
+			tw.timedOut = true
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// The client went away; there is no one to respond to.
+				return
+			}
+			AddLogAttrs(r.Context(),
+				slog.Bool("timed_out", true),
+				slog.Duration("timeout", d),
+			)
+			writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("request timed out after %s", d))
+		})
+	}
+}
+
+// timeoutWriter buffers a response so that it can be discarded if the
+// handler overruns its deadline. completed is set only when the handler
+// returned before the deadline, so a response is never half-delivered.
+type timeoutWriter struct {
+	ctx       context.Context
+	mu        sync.Mutex
+	header    http.Header
+	buf       bytes.Buffer
+	status    int
+	timedOut  bool
+	completed bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() || tw.status != 0 {
+		return
+	}
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+// expired reports whether the deadline has passed, latching timedOut so that
+// the response is discarded. It must be called with mu held.
+func (tw *timeoutWriter) expired() bool {
+	if tw.ctx.Err() != nil {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
@@ -0,0 +1,144 @@
+// Package instance identifies the process serving a request: the pod,
+// namespace and node it runs on, read from the Kubernetes downward API.
+package instance
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Info describes where the server is running. Fields are empty outside
+// Kubernetes or when the downward API does not provide them.
+type Info struct {
+	Pod       string            `json:"pod,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Node      string            `json:"node,omitempty"`
+	PodIP     string            `json:"pod_ip,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Environment variables set from the downward API with fieldRef.
+const (
+	EnvPod       = "POD_NAME"
+	EnvNamespace = "POD_NAMESPACE"
+	EnvNode      = "NODE_NAME"
+	EnvPodIP     = "POD_IP"
+)
+
+// Load reads the instance identity from environment variables and, when dir
+// is not empty, from a downward API volume mounted there holding any of the
+// files name, namespace and labels. Environment variables win over files.
+// The pod name falls back to the hostname, which Kubernetes sets to it.
+func Load(lookup func(string) (string, bool), dir string) (Info, error) {
+	var info Info
+	if dir != "" {
+		var err error
+		if info, err = readDir(dir); err != nil {
+			return Info{}, err
+		}
+	}
+
+	for key, field := range map[string]*string{
+		EnvPod:       &info.Pod,
+		EnvNamespace: &info.Namespace,
+		EnvNode:      &info.Node,
+		EnvPodIP:     &info.PodIP,
+	} {
+		if v, ok := lookup(key); ok && v != "" {
+			*field = v
+		}
+	}
+
+	if info.Pod == "" {
+		info.Pod, _ = os.Hostname()
+	}
+	return info, nil
+}
+
+// readDir reads a downward API volume. Missing files are skipped.
+func readDir(dir string) (Info, error) {
+	var info Info
+	for name, field := range map[string]*string{
+		"name":      &info.Pod,
+		"namespace": &info.Namespace,
+	} {
+		b, err := os.ReadFile(filepath.Join(dir, name)) // #nosec G304 -- dir comes from operator config
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Info{}, err
+		}
+		*field = strings.TrimSpace(string(b))
+	}
+
+	f, err := os.Open(filepath.Join(dir, "labels")) // #nosec G304 -- dir comes from operator config
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, nil
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info.Labels, err = parseLabels(bufio.NewScanner(f))
+	if err != nil {
+		return Info{}, fmt.Errorf("read %s: %w", f.Name(), err)
+	}
+	return info, nil
+}
+
+// parseLabels parses the downward API format, one key="quoted value" per
+// line.
+func parseLabels(sc *bufio.Scanner) (map[string]string, error) {
+	labels := map[string]string{}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		key, quoted, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label line %q", line)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %s: %w", key, err)
+		}
+		labels[key] = value
+	}
+	return labels, sc.Err()
+}
+
+// Name identifies the instance in the X-Served-By header: the pod name,
+// qualified by namespace when known.
+func (i Info) Name() string {
+	if i.Namespace == "" {
+		return i.Pod
+	}
+	return i.Namespace + "/" + i.Pod
+}
+
+// LogValue logs the identity without the labels, which would crowd every
+// record they are attached to.
+func (i Info) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, a := range []slog.Attr{
+		slog.String("pod", i.Pod),
+		slog.String("namespace", i.Namespace),
+		slog.String("node", i.Node),
+		slog.String("pod_ip", i.PodIP),
+	} {
+		if a.Value.String() != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
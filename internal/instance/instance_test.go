@@ -0,0 +1,122 @@
+package instance
+
+import (
+	"bytes"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lookupMap(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func writeDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad_FromEnv(t *testing.T) {
+	info, err := Load(lookupMap(map[string]string{
+		EnvPod:       "gitops-demo-7d9f-abcde",
+		EnvNamespace: "gitops-demo",
+		EnvNode:      "k3d-agent-0",
+		EnvPodIP:     "10.42.0.12",
+	}), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Info{Pod: "gitops-demo-7d9f-abcde", Namespace: "gitops-demo", Node: "k3d-agent-0", PodIP: "10.42.0.12"}
+	if info.Pod != want.Pod || info.Namespace != want.Namespace || info.Node != want.Node || info.PodIP != want.PodIP {
+		t.Errorf("expected %+v, got %+v", want, info)
+	}
+}
+
+func TestLoad_FromDownwardAPIVolume(t *testing.T) {
+	dir := writeDir(t, map[string]string{
+		"name":      "from-file\n",
+		"namespace": "gitops-demo\n",
+		"labels":    "app=\"gitops-demo\"\npod-template-hash=\"7d9f\"\nnote=\"a \\\"quoted\\\" value\"\n",
+	})
+
+	info, err := Load(lookupMap(map[string]string{EnvPod: "from-env"}), dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.Pod != "from-env" {
+		t.Errorf("expected the environment to win over the volume, got pod %q", info.Pod)
+	}
+	if info.Namespace != "gitops-demo" {
+		t.Errorf("expected namespace from the volume, got %q", info.Namespace)
+	}
+	want := map[string]string{"app": "gitops-demo", "pod-template-hash": "7d9f", "note": `a "quoted" value`}
+	if !maps.Equal(info.Labels, want) {
+		t.Errorf("expected labels %v, got %v", want, info.Labels)
+	}
+}
+
+func TestLoad_MissingFilesAndHostnameFallback(t *testing.T) {
+	info, err := Load(lookupMap(nil), t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	host, _ := os.Hostname()
+	if info.Pod != host {
+		t.Errorf("expected pod to fall back to hostname %q, got %q", host, info.Pod)
+	}
+	if info.Labels != nil {
+		t.Errorf("expected no labels, got %v", info.Labels)
+	}
+}
+
+func TestLoad_InvalidLabels(t *testing.T) {
+	for _, content := range []string{"no-equals-sign\n", "app=unquoted\n"} {
+		dir := writeDir(t, map[string]string{"labels": content})
+		if _, err := Load(lookupMap(nil), dir); err == nil {
+			t.Errorf("expected an error for labels %q", content)
+		}
+	}
+}
+
+func TestInfo_Name(t *testing.T) {
+	if got := (Info{Pod: "web-1", Namespace: "demo"}).Name(); got != "demo/web-1" {
+		t.Errorf("expected demo/web-1, got %q", got)
+	}
+	if got := (Info{Pod: "web-1"}).Name(); got != "web-1" {
+		t.Errorf("expected web-1, got %q", got)
+	}
+}
+
+func TestInfo_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("hello", slog.Any("instance", Info{Pod: "web-1", Node: "node-a", Labels: map[string]string{"app": "x"}}))
+
+	out := buf.String()
+	for _, want := range []string{"instance.pod=web-1", "instance.node=node-a"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"namespace", "pod_ip", "app"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected no %q in %s", unwanted, out)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package lifecycle starts and stops the parts of the application in
+// dependency order, bounding how long each may take to stop and reporting
+// those that did not stop cleanly.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Component is a part of the application with a start and a stop, such as
+// a server, a background worker or a client pool.
+type Component interface {
+	// Start brings the component up. ctx bounds the start only; work that
+	// continues afterwards must not stop when it is done.
+	Start(ctx context.Context) error
+	// Stop shuts the component down, giving up when ctx is done.
+	Stop(ctx context.Context) error
+}
+
+// Failer is implemented by components that keep working after Start and
+// can fail while doing so. Failed delivers at most one error.
+type Failer interface {
+	Failed() <-chan error
+}
+
+// Options describe how a component relates to the others.
+type Options struct {
+	// DependsOn names components that must start before this one and stop
+	// after it.
+	DependsOn []string
+	// StopTimeout bounds Stop within the overall shutdown deadline. Zero
+	// allows whatever time remains.
+	StopTimeout time.Duration
+}
+
+type entry struct {
+	name string
+	c    Component
+	opts Options
+}
+
+// Manager starts components in dependency order and stops them in reverse.
+// It is not safe for concurrent use.
+type Manager struct {
+	logger  *slog.Logger
+	entries []*entry
+	started []*entry
+}
+
+// New returns an empty Manager that logs to logger.
+func New(logger *slog.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// Add registers c under name. Components without dependencies between them
+// start in the order they were added. Add panics if name is already taken.
+func (m *Manager) Add(name string, c Component, opts Options) {
+	if m.lookup(name) != nil {
+		panic(fmt.Sprintf("lifecycle: component %q added twice", name))
+	}
+	m.entries = append(m.entries, &entry{name: name, c: c, opts: opts})
+}
+
+func (m *Manager) lookup(name string) *entry {
+	for _, e := range m.entries {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// order returns the components sorted so that each follows its
+// dependencies, keeping the order they were added where it is free.
+func (m *Manager) order() ([]*entry, error) {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[*entry]int, len(m.entries))
+	out := make([]*entry, 0, len(m.entries))
+
+	var visit func(e *entry, path []string) error
+	visit = func(e *entry, path []string) error {
+		switch state[e] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), e.name)
+		}
+		state[e] = visiting
+		for _, dep := range e.opts.DependsOn {
+			d := m.lookup(dep)
+			if d == nil {
+				return fmt.Errorf("component %s depends on unknown component %s", e.name, dep)
+			}
+			if err := visit(d, append(path, e.name)); err != nil {
+				return err
+			}
+		}
+		state[e] = done
+		out = append(out, e)
+		return nil
+	}
+
+	for _, e := range m.entries {
+		if err := visit(e, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Start starts every component in dependency order. If one fails, those
+// already started are stopped again, in reverse, and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	order, err := m.order()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range order {
+		start := time.Now()
+		if err := e.c.Start(ctx); err != nil {
+			m.logger.Error("component failed to start", slog.String("component", e.name), slog.String("error", err.Error()))
+			m.Stop(context.WithoutCancel(ctx))
+			return fmt.Errorf("start %s: %w", e.name, err)
+		}
+		m.started = append(m.started, e)
+		m.logger.Debug("component started", slog.String("component", e.name), slog.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+// Wait blocks until ctx is done, returning nil, or until a started
+// component reports a failure, returning it.
+func (m *Manager) Wait(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	failed := make(chan error, len(m.started))
+	for _, e := range m.started {
+		f, ok := e.c.(Failer)
+		if !ok {
+			continue
+		}
+		go func() {
+			select {
+			case err := <-f.Failed():
+				if err != nil {
+					failed <- fmt.Errorf("%s: %w", e.name, err)
+				}
+			case <-stop:
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-failed:
+		return err
+	}
+}
+
+// Result is the outcome of stopping one component.
+type Result struct {
+	Component string
+	Duration  time.Duration
+	Err       error
+}
+
+// Report lists the outcome of stopping each component, in stop order.
+type Report []Result
+
+// Failed returns the components that did not stop cleanly.
+func (r Report) Failed() []string {
+	var names []string
+	for _, res := range r {
+		if res.Err != nil {
+			names = append(names, res.Component)
+		}
+	}
+	return names
+}
+
+// Err joins the errors of the components that did not stop cleanly, or
+// returns nil if all did.
+func (r Report) Err() error {
+	var errs []error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Component, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ErrStopTimeout is reported for a component whose Stop did not return in
+// time. Its Stop is abandoned, still running, so that the others can stop.
+var ErrStopTimeout = errors.New("did not stop in time")
+
+// Stop stops the started components in reverse dependency order. Each gets
+// its StopTimeout, cut short by ctx, which carries the overall deadline;
+// once that passes, the remaining components are still asked to stop but
+// only get a done context.
+func (m *Manager) Stop(ctx context.Context) Report {
+	var report Report
+	for _, e := range slices.Backward(m.started) {
+		res := Result{Component: e.name}
+		start := time.Now()
+		res.Err = stopOne(ctx, e)
+		res.Duration = time.Since(start)
+		report = append(report, res)
+
+		if res.Err != nil {
+			m.logger.Warn("component did not stop cleanly",
+				slog.String("component", e.name),
+				slog.Duration("duration", res.Duration),
+				slog.String("error", res.Err.Error()),
+			)
+		} else {
+			m.logger.Debug("component stopped", slog.String("component", e.name), slog.Duration("duration", res.Duration))
+		}
+	}
+	m.started = nil
+	return report
+}
+
+func stopOne(ctx context.Context, e *entry) error {
+	if e.opts.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.opts.StopTimeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- e.c.Stop(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrStopTimeout, ctx.Err())
+	}
+}
+
+// Hooks adapts a pair of functions to a Component. Either may be nil.
+type Hooks struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Start calls OnStart.
+func (h Hooks) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop calls OnStop.
+func (h Hooks) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// Background returns a Component that runs fn in a goroutine from Start
+// until Stop cancels its context and it returns. An error from fn before
+// Stop is reported through Failed.
+func Background(fn func(ctx context.Context) error) Component {
+	return &background{fn: fn}
+}
+
+type background struct {
+	fn     func(ctx context.Context) error
+	cancel context.CancelFunc
+	done   chan struct{}
+	failed chan error
+}
+
+func (b *background) Start(ctx context.Context) error {
+	ctx, b.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	b.done = make(chan struct{})
+	b.failed = make(chan error, 1)
+	go func() {
+		defer close(b.done)
+		if err := b.fn(ctx); err != nil && ctx.Err() == nil {
+			b.failed <- err
+		}
+	}()
+	return nil
+}
+
+func (b *background) Failed() <-chan error {
+	return b.failed
+}
+
+func (b *background) Stop(ctx context.Context) error {
+	b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
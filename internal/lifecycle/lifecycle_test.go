@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// callLog records component calls from any goroutine.
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *callLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.calls)
+}
+
+// recorder is a Component that records its calls in a shared log.
+type recorder struct {
+	name     string
+	calls    *callLog
+	startErr error
+	stop     func(ctx context.Context) error
+}
+
+func (r *recorder) Start(context.Context) error {
+	r.calls.add("start " + r.name)
+	return r.startErr
+}
+
+func (r *recorder) Stop(ctx context.Context) error {
+	r.calls.add("stop " + r.name)
+	if r.stop != nil {
+		return r.stop(ctx)
+	}
+	return nil
+}
+
+func TestManager_DependencyOrder(t *testing.T) {
+	var calls callLog
+	m := New(discardLogger())
+	m.Add("http", &recorder{name: "http", calls: &calls}, Options{DependsOn: []string{"db", "cache"}})
+	m.Add("worker", &recorder{name: "worker", calls: &calls}, Options{})
+	m.Add("cache", &recorder{name: "cache", calls: &calls}, Options{DependsOn: []string{"db"}})
+	m.Add("db", &recorder{name: "db", calls: &calls}, Options{})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	report := m.Stop(context.Background())
+
+	want := []string{
+		"start db", "start cache", "start http", "start worker",
+		"stop worker", "stop http", "stop cache", "stop db",
+	}
+	if !slices.Equal(calls.get(), want) {
+		t.Errorf("expected calls %v, got %v", want, calls.get())
+	}
+	if report.Err() != nil || len(report) != 4 {
+		t.Errorf("expected a clean report of 4 components, got %+v", report)
+	}
+}
+
+func TestManager_InvalidDependencies(t *testing.T) {
+	var calls callLog
+
+	m := New(discardLogger())
+	m.Add("a", &recorder{name: "a", calls: &calls}, Options{DependsOn: []string{"missing"}})
+	if err := m.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown component missing") {
+		t.Errorf("expected an unknown dependency error, got %v", err)
+	}
+
+	m = New(discardLogger())
+	m.Add("a", &recorder{name: "a", calls: &calls}, Options{DependsOn: []string{"b"}})
+	m.Add("b", &recorder{name: "b", calls: &calls}, Options{DependsOn: []string{"a"}})
+	if err := m.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "dependency cycle: a -> b -> a") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+	if got := calls.get(); len(got) != 0 {
+		t.Errorf("expected nothing to start, got %v", got)
+	}
+}
+
+func TestManager_StartFailureStopsStarted(t *testing.T) {
+	var calls callLog
+	m := New(discardLogger())
+	m.Add("db", &recorder{name: "db", calls: &calls}, Options{})
+	m.Add("http", &recorder{name: "http", calls: &calls, startErr: errors.New("address in use")}, Options{DependsOn: []string{"db"}})
+
+	err := m.Start(context.Background())
+	if err == nil || err.Error() != "start http: address in use" {
+		t.Errorf("expected the start error, got %v", err)
+	}
+	if want := []string{"start db", "start http", "stop db"}; !slices.Equal(calls.get(), want) {
+		t.Errorf("expected calls %v, got %v", want, calls.get())
+	}
+}
+
+func TestManager_StopTimeouts(t *testing.T) {
+	var calls callLog
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second) // ignores the deadline
+		return nil
+	}
+	var buf bytes.Buffer
+	m := New(slog.New(slog.NewTextHandler(&buf, nil)))
+	m.Add("db", &recorder{name: "db", calls: &calls}, Options{})
+	m.Add("worker", &recorder{name: "worker", calls: &calls, stop: hang}, Options{DependsOn: []string{"db"}, StopTimeout: 20 * time.Millisecond})
+	m.Add("cache", &recorder{name: "cache", calls: &calls, stop: func(context.Context) error { return errors.New("flush failed") }}, Options{DependsOn: []string{"db"}})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	report := m.Stop(context.Background())
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the worker to be abandoned after its timeout, took %v", elapsed)
+	}
+	if got := report.Failed(); !slices.Equal(got, []string{"cache", "worker"}) {
+		t.Errorf("expected cache and worker to fail, got %v", got)
+	}
+	if err := report.Err(); !errors.Is(err, ErrStopTimeout) || !strings.Contains(err.Error(), "cache: flush failed") {
+		t.Errorf("unexpected report error: %v", err)
+	}
+	if !slices.Contains(calls.get(), "stop db") {
+		t.Error("expected db to be stopped after the others")
+	}
+	if !strings.Contains(buf.String(), `msg="component did not stop cleanly" component=worker`) {
+		t.Errorf("expected the failure to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestManager_StopWithinOverallDeadline(t *testing.T) {
+	var calls callLog
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	m := New(discardLogger())
+	m.Add("http", &recorder{name: "http", calls: &calls, stop: slow}, Options{StopTimeout: time.Hour})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Stop(ctx).Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the overall deadline to cut the stop timeout short, got %v", err)
+	}
+}
+
+func TestBackground(t *testing.T) {
+	running := make(chan struct{})
+	c := Background(func(ctx context.Context) error {
+		close(running)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel() // the start context must not stop the work
+	<-running
+	select {
+	case err := <-c.(Failer).Failed():
+		t.Fatalf("unexpected failure %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := c.Stop(context.Background()); err != nil {
+		t.Errorf("unexpected stop error: %v", err)
+	}
+}
+
+func TestManager_WaitReportsFailure(t *testing.T) {
+	m := New(discardLogger())
+	m.Add("worker", Background(func(context.Context) error { return errors.New("lost connection") }), Options{})
+	m.Add("idle", Hooks{}, Options{})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Wait(ctx); err == nil || err.Error() != "worker: lost connection" {
+		t.Errorf("expected the worker failure, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	m2 := New(discardLogger())
+	m2.Add("idle", Hooks{}, Options{})
+	if err := m2.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Wait(ctx); err != nil {
+		t.Errorf("expected nil once ctx is done, got %v", err)
+	}
+}
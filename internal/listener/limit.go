@@ -0,0 +1,64 @@
+package listener
+
+import (
+	"net"
+	"sync"
+)
+
+// ConnLimit caps the number of open connections across every listener it
+// wraps. Once the limit is reached, Accept waits for a connection to close,
+// leaving new clients queued in the kernel's accept backlog.
+type ConnLimit struct {
+	sem chan struct{}
+}
+
+// NewConnLimit returns a limit of n open connections.
+func NewConnLimit(n int) *ConnLimit {
+	return &ConnLimit{sem: make(chan struct{}, n)}
+}
+
+// Listener wraps ln so that its connections count against the limit.
+func (l *ConnLimit) Listener(ln net.Listener) net.Listener {
+	return &limitListener{Listener: ln, sem: l.sem, done: make(chan struct{})}
+}
+
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		// Closed while waiting for a slot; let the caller see the error.
+		return l.Listener.Accept()
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, sem: l.sem}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn frees its slot when closed.
+type limitConn struct {
+	net.Conn
+	sem         chan struct{}
+	releaseOnce sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(func() { <-c.sem })
+	return err
+}
@@ -0,0 +1,76 @@
+package listener
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnLimit_WaitsForFreeSlot(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := NewConnLimit(1).Listener(raw)
+	defer func() { _ = ln.Close() }()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for range 2 {
+		c, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer func() { _ = c.Close() }()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("expected the second connection to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_ = first.Close()
+	select {
+	case c := <-accepted:
+		_ = c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second connection once the first closed")
+	}
+}
+
+func TestConnLimit_CloseUnblocksAccept(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	limit := NewConnLimit(1)
+	limit.sem <- struct{}{} // the only slot is taken
+	ln := limit.Listener(raw)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ln.Accept()
+		errCh <- err
+	}()
+	_ = ln.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected Accept to fail on a closed listener")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept did not return after Close")
+	}
+}
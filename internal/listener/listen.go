@@ -0,0 +1,255 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Addr is a parsed listen address.
+type Addr struct {
+	// Network is one of tcp, tcp4, tcp6, unix or systemd.
+	Network string
+	// Address is the host:port for TCP, the socket path for unix, and the
+	// optional LISTEN_FDNAMES name for systemd.
+	Address string
+}
+
+// ParseAddr parses a listen address. Accepted forms are host:port (bind
+// every address family the host resolves to), tcp4:host:port and
+// tcp6:host:port (bind one family only), unix:/path/to.sock, and systemd or
+// systemd:name for sockets passed in by systemd socket activation.
+func ParseAddr(s string) (Addr, error) {
+	network, rest, found := strings.Cut(s, ":")
+	switch {
+	case found && network == "unix":
+		if rest == "" {
+			return Addr{}, fmt.Errorf("listen address %q: missing socket path", s)
+		}
+		return Addr{Network: network, Address: rest}, nil
+	case network == "systemd":
+		return Addr{Network: network, Address: rest}, nil
+	case found && (network == "tcp" || network == "tcp4" || network == "tcp6"):
+	default:
+		network, rest = "tcp", s
+	}
+	if _, _, err := net.SplitHostPort(rest); err != nil {
+		return Addr{}, fmt.Errorf("listen address %q: %w", s, err)
+	}
+	return Addr{Network: network, Address: rest}, nil
+}
+
+// Listener is an open listener and the listen address it was opened for.
+type Listener struct {
+	net.Listener
+	Entry string
+}
+
+// Options configures Listen.
+type Options struct {
+	// SocketMode is applied to Unix domain sockets once they are created.
+	// Zero leaves the mode set by the process umask.
+	SocketMode fs.FileMode
+	// Inherited are listeners handed over by a previous process. They are
+	// used instead of opening a new socket for any address with the same
+	// Entry, and closed if no address claims them.
+	Inherited []Listener
+}
+
+// Listen opens a listener for every address, as accepted by ParseAddr. A
+// systemd address may yield several listeners. If any address fails, the
+// listeners already opened are closed.
+func Listen(addrs []string, opts Options) ([]Listener, error) {
+	var (
+		out       []Listener
+		inherited []namedListener
+		consumed  bool
+	)
+	handed := slices.Clone(opts.Inherited)
+	closeUnclaimed := func() {
+		for _, nl := range inherited {
+			_ = nl.Close()
+		}
+		for _, ln := range handed {
+			_ = ln.Close()
+		}
+	}
+	fail := func(err error) ([]Listener, error) {
+		for _, ln := range out {
+			_ = ln.Close()
+		}
+		closeUnclaimed()
+		return nil, err
+	}
+
+	for _, s := range addrs {
+		addr, err := ParseAddr(s)
+		if err != nil {
+			return fail(err)
+		}
+
+		var reused bool
+		handed = slices.DeleteFunc(handed, func(ln Listener) bool {
+			if ln.Entry != s {
+				return false
+			}
+			out = append(out, ln)
+			reused = true
+			return true
+		})
+		if reused {
+			continue
+		}
+
+		switch addr.Network {
+		case "systemd":
+			if !consumed {
+				inherited, err = systemdListeners(os.LookupEnv, listenFDsStart)
+				if err != nil {
+					return fail(err)
+				}
+				unsetSystemdEnv()
+				consumed = true
+			}
+			var matched bool
+			inherited = slices.DeleteFunc(inherited, func(nl namedListener) bool {
+				if addr.Address != "" && nl.name != addr.Address {
+					return false
+				}
+				out = append(out, Listener{Listener: nl.Listener, Entry: s})
+				matched = true
+				return true
+			})
+			if !matched {
+				return fail(fmt.Errorf("listen address %q: no matching socket passed by systemd", s))
+			}
+		case "unix":
+			ln, err := listenUnix(addr.Address, opts.SocketMode)
+			if err != nil {
+				return fail(err)
+			}
+			out = append(out, Listener{Listener: ln, Entry: s})
+		default:
+			ln, err := net.Listen(addr.Network, addr.Address)
+			if err != nil {
+				return fail(err)
+			}
+			out = append(out, Listener{Listener: ln, Entry: s})
+		}
+	}
+
+	// Sockets passed in that no address claimed would otherwise leak.
+	closeUnclaimed()
+	return out, nil
+}
+
+// listenUnix listens on a Unix domain socket at path, first removing a socket
+// file left behind by a process that is no longer listening on it. Abstract
+// sockets (a path starting with @) have no file and are used as is.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	abstract := strings.HasPrefix(path, "@")
+	if !abstract {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 && !abstract {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("set socket mode: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the socket at path unless another process is
+// still accepting connections on it. Anything other than a socket is left
+// alone and reported as an error.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// listenFDsStart is the first file descriptor passed by systemd, following
+// stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// namedListener is a listener inherited from systemd with its
+// LISTEN_FDNAMES entry.
+type namedListener struct {
+	net.Listener
+	name string
+}
+
+// systemdListeners returns the listeners passed by systemd socket activation,
+// as described by sd_listen_fds(3). Descriptors are numbered from start.
+func systemdListeners(lookup func(string) (string, bool), start int) ([]namedListener, error) {
+	pid, _ := lookup("LISTEN_PID")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New("no sockets passed by systemd: LISTEN_PID is not this process")
+	}
+	v, _ := lookup("LISTEN_FDS")
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("no sockets passed by systemd: invalid LISTEN_FDS %q", v)
+	}
+	var names []string
+	if v, ok := lookup("LISTEN_FDNAMES"); ok {
+		names = strings.Split(v, ":")
+	}
+
+	out := make([]namedListener, 0, n)
+	for i := range n {
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		// FileListener duplicates the descriptor, so the original is
+		// closed either way.
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, nl := range out {
+				_ = nl.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %d (%s): %w", start+i, name, err)
+		}
+		out = append(out, namedListener{Listener: ln, name: name})
+	}
+	return out, nil
+}
+
+// unsetSystemdEnv stops child processes from believing the sockets were
+// passed to them.
+func unsetSystemdEnv() {
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(key)
+	}
+}
@@ -0,0 +1,208 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Addr
+	}{
+		{":8080", Addr{"tcp", ":8080"}},
+		{"127.0.0.1:8080", Addr{"tcp", "127.0.0.1:8080"}},
+		{"[::1]:8080", Addr{"tcp", "[::1]:8080"}},
+		{"tcp4:0.0.0.0:8080", Addr{"tcp4", "0.0.0.0:8080"}},
+		{"tcp6:[::]:8080", Addr{"tcp6", "[::]:8080"}},
+		{"unix:/run/gitops-demo.sock", Addr{"unix", "/run/gitops-demo.sock"}},
+		{"systemd", Addr{"systemd", ""}},
+		{"systemd:http", Addr{"systemd", "http"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAddr(tt.in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseAddr_Invalid(t *testing.T) {
+	for _, in := range []string{"8080", "unix:", "tcp4:localhost", "[::1]"} {
+		if _, err := ParseAddr(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestListen_MultipleAddresses(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	lns, err := Listen([]string{"tcp4:127.0.0.1:0", "unix:" + sock}, Options{SocketMode: 0o600})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+	}()
+
+	if len(lns) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(lns))
+	}
+	if got := lns[0].Addr().Network(); got != "tcp" {
+		t.Errorf("expected a tcp listener, got %s", got)
+	}
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0o600 {
+		t.Errorf("expected socket mode 0600, got %o", got)
+	}
+}
+
+func TestListen_ClosesOpenedOnFailure(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	if _, err := Listen([]string{"unix:" + sock, "tcp4:[::1]:0"}, Options{}); err == nil {
+		t.Fatal("expected an error for an IPv6 address on tcp4")
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("expected the unix socket to be closed and removed, got %v", err)
+	}
+}
+
+func TestListenUnix_RemovesStaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// Leave the socket file behind, as a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := listenUnix(sock, 0)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %v", err)
+	}
+	_ = ln.Close()
+}
+
+func TestListenUnix_SocketInUse(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	live, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = live.Close() }()
+
+	if _, err := listenUnix(sock, 0); err == nil {
+		t.Error("expected an error for a socket in use")
+	}
+}
+
+func TestListenUnix_NotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listenUnix(path, 0); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the file to be left alone, got %v", err)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = tcp.Close() }()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("file: %v", err)
+	}
+	// systemdListeners takes ownership of the descriptor, as it would of one
+	// passed by systemd, so hand it a copy that no *os.File will close.
+	fd, err := syscall.Dup(int(f.Fd()))
+	_ = f.Close()
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "http",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	lns, err := systemdListeners(lookup, fd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = lns[0].Close() }()
+
+	if lns[0].name != "http" {
+		t.Errorf("expected name http, got %q", lns[0].name)
+	}
+	if got, want := lns[0].Addr().String(), tcp.Addr().String(); got != want {
+		t.Errorf("expected inherited listener on %s, got %s", want, got)
+	}
+}
+
+func TestSystemdListeners_OtherProcess(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		if key == "LISTEN_PID" {
+			return strconv.Itoa(os.Getpid() + 1), true
+		}
+		return "1", true
+	}
+	if _, err := systemdListeners(lookup, listenFDsStart); err == nil {
+		t.Error("expected an error when LISTEN_PID is another process")
+	}
+}
+
+func TestListen_ReusesInherited(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	unclaimed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	inherited := []Listener{
+		{Listener: tcp, Entry: "127.0.0.1:8080"},
+		{Listener: unclaimed, Entry: "127.0.0.1:9090"},
+	}
+
+	lns, err := Listen([]string{"127.0.0.1:8080"}, Options{Inherited: inherited})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = lns[0].Close() }()
+
+	if len(lns) != 1 || lns[0].Listener != tcp {
+		t.Errorf("expected the inherited listener to be reused, got %v", lns)
+	}
+	if _, err := unclaimed.Accept(); err == nil {
+		t.Error("expected the unclaimed listener to be closed")
+	}
+}
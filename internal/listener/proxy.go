@@ -0,0 +1,46 @@
+// Package listener builds the network listeners the HTTP server accepts
+// connections on.
+package listener
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// ProxyProtocol wraps ln so that PROXY protocol v1 and v2 headers sent by
+// peers in trusted are parsed, making the original client address the
+// connection's RemoteAddr. The header is optional for trusted peers, and a
+// trusted peer that sends nothing within timeout is served as a plain
+// connection. Headers from any other peer are not interpreted, so an
+// untrusted client cannot spoof its address; the bytes reach the HTTP server
+// unchanged and are rejected there as a malformed request.
+func ProxyProtocol(ln net.Listener, trusted []netip.Prefix, timeout time.Duration) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          ln,
+		ReadHeaderTimeout: timeout,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if isTrusted(upstream, trusted) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.SKIP, nil
+		},
+	}
+}
+
+// isTrusted reports whether addr is a TCP peer inside one of the prefixes.
+func isTrusted(addr net.Addr, trusted []netip.Prefix) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip := tcp.AddrPort().Addr().Unmap()
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
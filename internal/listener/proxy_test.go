@@ -0,0 +1,114 @@
+package listener
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+// acceptOne listens on loopback through ProxyProtocol, dials it, writes
+// payload and returns the accepted server side of the connection.
+func acceptOne(t *testing.T, trusted []netip.Prefix, payload []byte) net.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	pl := ProxyProtocol(ln, trusted, time.Second)
+	t.Cleanup(func() { _ = pl.Close() })
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	if _, err := client.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func header(t *testing.T, version byte, src string) []byte {
+	t.Helper()
+	h := proxyproto.HeaderProxyFromAddrs(version,
+		net.TCPAddrFromAddrPort(netip.MustParseAddrPort(src)),
+		net.TCPAddrFromAddrPort(netip.MustParseAddrPort("192.0.2.10:443")),
+	)
+	b, err := h.Format()
+	if err != nil {
+		t.Fatalf("format header: %v", err)
+	}
+	return b
+}
+
+func readLine(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && err != io.EOF {
+		t.Fatalf("read: %v", err)
+	}
+	return line
+}
+
+func TestProxyProtocol_TrustedHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		version byte
+		src     string
+	}{
+		{"v1 IPv4", 1, "203.0.113.7:51000"},
+		{"v2 IPv4", 2, "203.0.113.7:51000"},
+		{"v2 IPv6", 2, "[2001:db8::7]:51000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := append(header(t, tt.version, tt.src), "GET / HTTP/1.1\r\n"...)
+			conn := acceptOne(t, loopback, payload)
+
+			if got := conn.RemoteAddr().String(); got != tt.src {
+				t.Errorf("expected RemoteAddr %s, got %s", tt.src, got)
+			}
+			if got := readLine(t, conn); got != "GET / HTTP/1.1\r\n" {
+				t.Errorf("expected header to be stripped, got %q", got)
+			}
+		})
+	}
+}
+
+func TestProxyProtocol_TrustedWithoutHeader(t *testing.T) {
+	conn := acceptOne(t, loopback, []byte("GET / HTTP/1.1\r\n"))
+
+	if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Errorf("expected the peer address, got %s", got)
+	}
+	if got := readLine(t, conn); got != "GET / HTTP/1.1\r\n" {
+		t.Errorf("expected request line, got %q", got)
+	}
+}
+
+func TestProxyProtocol_UntrustedHeaderIgnored(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	conn := acceptOne(t, trusted, header(t, 1, "203.0.113.7:51000"))
+
+	if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Errorf("expected the peer address, got %s", got)
+	}
+	if got := readLine(t, conn); !strings.HasPrefix(got, "PROXY TCP4 203.0.113.7") {
+		t.Errorf("expected the header to be passed through unparsed, got %q", got)
+	}
+}
@@ -0,0 +1,190 @@
+// Package restart replaces the running server with a new copy of its binary
+// without closing its listening sockets. The parent starts the child with
+// the sockets as extra file descriptors and waits for it to report ready;
+// the child serves on the inherited sockets while the parent drains.
+package restart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/mstephenholl/gitops-demo/internal/listener"
+)
+
+// envListeners names the environment variable holding the JSON list of
+// listen addresses for the inherited descriptors, in order.
+const envListeners = "GRACEFUL_RESTART_LISTENERS"
+
+// The child's descriptor 3 is the ready pipe, followed by one descriptor
+// per listener.
+const (
+	readyFD       = 3
+	firstListenFD = readyFD + 1
+)
+
+// Child is the state a process started by Spawn inherits.
+type Child struct {
+	// Listeners are the parent's listeners, tagged with their listen
+	// addresses so listener.Listen can reuse them.
+	Listeners []listener.Listener
+	ready     *os.File
+}
+
+// Inherit returns the listeners passed by a parent process, or nil if the
+// process was not started by Spawn.
+func Inherit() (*Child, error) {
+	v, ok := os.LookupEnv(envListeners)
+	if !ok {
+		return nil, nil
+	}
+	_ = os.Unsetenv(envListeners)
+	return inherit(v, firstListenFD)
+}
+
+func inherit(v string, first int) (*Child, error) {
+	var entries []string
+	if err := json.Unmarshal([]byte(v), &entries); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", envListeners, err)
+	}
+
+	c := &Child{ready: os.NewFile(uintptr(first-1), "ready")}
+	for i, entry := range entries {
+		f := os.NewFile(uintptr(first+i), entry)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("inherit listener %s: %w", entry, err)
+		}
+		c.Listeners = append(c.Listeners, listener.Listener{Listener: ln, Entry: entry})
+	}
+	return c, nil
+}
+
+// Ready tells the parent that the child is accepting connections, so the
+// parent can start draining. It must be called at most once.
+func (c *Child) Ready() error {
+	defer func() { _ = c.ready.Close() }()
+	if _, err := c.ready.Write([]byte{1}); err != nil {
+		return fmt.Errorf("signal ready: %w", err)
+	}
+	return nil
+}
+
+func (c *Child) close() {
+	_ = c.ready.Close()
+	for _, ln := range c.Listeners {
+		_ = ln.Close()
+	}
+}
+
+// Spawn starts a new copy of the running binary, with the same arguments and
+// environment, handing it lns. It returns once the child has called Ready,
+// after which the caller should drain and exit. If the child exits or does
+// not become ready within timeout, it is killed and an error is returned;
+// the caller keeps serving on lns either way.
+func Spawn(lns []listener.Listener, timeout time.Duration) (*os.Process, error) {
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("find executable: %w", err)
+	}
+	return spawn(exec.Command(path, os.Args[1:]...), lns, timeout) // #nosec G204 -- re-executes this binary
+}
+
+// filer is implemented by the listeners whose socket can be handed over.
+type filer interface {
+	File() (*os.File, error)
+}
+
+func spawn(cmd *exec.Cmd, lns []listener.Listener, timeout time.Duration) (*os.Process, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	files := []*os.File{w}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	entries := make([]string, 0, len(lns))
+	for _, ln := range lns {
+		fl, ok := ln.Listener.(filer)
+		if !ok {
+			return nil, fmt.Errorf("listener %s cannot be handed over", ln.Entry)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", ln.Entry, err)
+		}
+		files = append(files, f)
+		entries = append(entries, ln.Entry)
+	}
+	env, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// The socket file now belongs to the child too; closing our listener
+	// while draining must not remove it. If the child fails the file is
+	// left behind at exit and cleaned up as stale by the next start.
+	keepSocketFiles(lns)
+
+	cmd.Env = append(cmd.Environ(), envListeners+"="+string(env))
+	cmd.ExtraFiles = files
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start child: %w", err)
+	}
+
+	// Close our copy of the write end so that the read below sees EOF if
+	// the child exits without signalling.
+	_ = w.Close()
+	files = files[1:]
+
+	if err := waitReady(r, timeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	_, err := r.Read(make([]byte, 1))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF):
+		return errors.New("child exited before becoming ready")
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return fmt.Errorf("child not ready after %s", timeout)
+	default:
+		return fmt.Errorf("wait for child: %w", err)
+	}
+}
+
+func keepSocketFiles(lns []listener.Listener) {
+	for _, ln := range lns {
+		if ul, ok := ln.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
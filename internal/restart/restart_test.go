@@ -0,0 +1,129 @@
+package restart
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/mstephenholl/gitops-demo/internal/listener"
+)
+
+// childEnv selects what the re-executed test binary does as a child.
+const childEnv = "RESTART_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(childEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "serve":
+		serveOnce()
+	case "exit":
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+	}
+	os.Exit(0)
+}
+
+// serveOnce inherits the listeners, reports ready and answers one
+// connection with the entry of the listener it arrived on.
+func serveOnce() {
+	child, err := Inherit()
+	if err != nil || child == nil || len(child.Listeners) != 1 {
+		os.Exit(2)
+	}
+	if err := child.Ready(); err != nil {
+		os.Exit(3)
+	}
+	ln := child.Listeners[0]
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	_, _ = io.WriteString(conn, ln.Entry+"\n")
+	_ = conn.Close()
+}
+
+func testCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), childEnv+"="+mode)
+	return cmd
+}
+
+func testListener(t *testing.T) listener.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	return listener.Listener{Listener: ln, Entry: "127.0.0.1:0"}
+}
+
+func TestSpawn_HandsOverListener(t *testing.T) {
+	ln := testListener(t)
+
+	proc, err := spawn(testCommand("serve"), []listener.Listener{ln}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Stop accepting in the parent so that only the child can answer.
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != ln.Entry+"\n" {
+		t.Errorf("expected the child to answer for %s, got %q", ln.Entry, line)
+	}
+
+	state, err := proc.Wait()
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if !state.Success() {
+		t.Errorf("child exited with %v", state)
+	}
+}
+
+func TestSpawn_ChildExits(t *testing.T) {
+	if _, err := spawn(testCommand("exit"), []listener.Listener{testListener(t)}, 10*time.Second); err == nil {
+		t.Error("expected an error when the child exits before becoming ready")
+	}
+}
+
+func TestSpawn_ChildNotReady(t *testing.T) {
+	start := time.Now()
+	if _, err := spawn(testCommand("hang"), []listener.Listener{testListener(t)}, 200*time.Millisecond); err == nil {
+		t.Error("expected an error when the child does not become ready")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected spawn to give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestInherit_NotAChild(t *testing.T) {
+	child, err := Inherit()
+	if err != nil || child != nil {
+		t.Errorf("expected no inherited state, got %v, %v", child, err)
+	}
+}
+
+func TestInherit_InvalidEnv(t *testing.T) {
+	if _, err := inherit("not json", firstListenFD); err == nil {
+		t.Error("expected an error for a malformed listener list")
+	}
+}